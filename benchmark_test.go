@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/golUtils"
 )
 
 const benchLength = 1000
@@ -23,7 +24,58 @@ func BenchmarkGol(b *testing.B) {
 	b.Run(name, func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
 			events := make(chan gol.Event)
-			gol.Run(p, events, nil)
+			go gol.Run(p, events, nil)
+			for range events {
+			}
 		}
 	})
 }
+
+// threadedEngines are the engines that split each turn across Params.Threads goroutines, which are the
+// only ones worth comparing across thread counts.
+var threadedEngines = map[string]bool{"dense": true, "bitboard": true}
+
+// BenchmarkEngines compares the engines, and how the threaded ones scale with threads, by stepping them
+// directly so that none of the time goes on gol.Run's events.
+func BenchmarkEngines(b *testing.B) {
+	file, err := os.Open("images/512x512.pgm")
+	if err != nil {
+		b.Fatal(err)
+	}
+	world, err := golUtils.ReadNetpbm(file)
+	file.Close()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, engine := range golUtils.EngineNames {
+		threadCounts := []int{1}
+		if threadedEngines[engine] {
+			threadCounts = []int{1, 2, 4, 8, 16}
+		}
+		for _, threads := range threadCounts {
+			p := golUtils.Params{
+				Turns:       benchLength,
+				Threads:     threads,
+				ImageWidth:  512,
+				ImageHeight: 512,
+				Rule:        golUtils.Conway,
+				Engine:      engine,
+			}
+			name := fmt.Sprintf("%s-%dx%dx%d-%d", p.Engine, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					e, err := golUtils.NewEngine(p, world, golUtils.CoOrds{})
+					if err != nil {
+						b.Fatal(err)
+					}
+					b.StartTimer()
+					for turn := 0; turn < p.Turns; {
+						turn += e.Step(p.Turns - turn)
+					}
+				}
+			})
+		}
+	}
+}
@@ -1,5 +1,44 @@
 package main
 
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/rpc"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
 func main() {
+	haloExchange := flag.Bool(
+		"halo",
+		false,
+		"Let workers own their strip and exchange halo rows with each other directly.")
+	port := flag.String(
+		"port",
+		"8030",
+		"Port to listen on.")
+	flag.Parse()
+
+	rand.Seed(time.Now().UnixNano())
+
+	shutdown := make(chan struct{})
+	broker := engine.NewBroker(*haloExchange, func() { close(shutdown) })
+
+	// Register under the worker's name so the distributor's stubs work unchanged
+	err := rpc.RegisterName("GOLWorker", broker.Server)
+	util.Check(err)
+	err = rpc.RegisterName("Broker", broker.Pool)
+	util.Check(err)
+	listener, err := engine.Listen(rpc.DefaultServer, ":"+*port)
+	util.Check(err)
+	fmt.Println(listener.Addr())
 
+	// Once the calculations have stopped, take the workers down with us, then reply to any other calls
+	<-shutdown
+	broker.ShutdownWorkers()
+	listener.Close()
+	fmt.Println("Broker shut down")
 }
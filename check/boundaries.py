@@ -0,0 +1,97 @@
+# Generates the images in check/images/{dead,reflect,klein,infinite}, which TestBoundaries checks against.
+# It is written independently of the Go code on purpose, so the two can't share a mistake.
+#
+#   python3 check/boundaries.py check/images
+#
+# run from the root of the repository. Every image is run for 100 turns with Conway's rule, saving turns 1 and 100.
+import os
+import sys
+
+
+def read_pgm(path):
+    data = open(path, 'rb').read()
+    parts = data.split(b'\n', 3)
+    assert parts[0] == b'P5'
+    w, h = map(int, parts[1].split())
+    px = parts[3]
+    return w, h, {(i % w, i // w) for i, v in enumerate(px[:w*h]) if v == 255}
+
+
+def write_pgm(path, w, h, live):
+    px = bytearray(w*h)
+    for x, y in live:
+        px[y*w + x] = 255
+    with open(path, 'wb') as f:
+        f.write(b'P5\n%d %d\n255\n' % (w, h))
+        f.write(bytes(px))
+
+
+def mapper(mode, w, h):
+    """Maps a cell off the edge of the image to the cell it stands for, or None if it is always dead."""
+    def m(x, y):
+        if 0 <= x < w and 0 <= y < h:
+            return (x, y)
+        if mode == 'reflect':
+            return (min(max(x, 0), w-1), min(max(y, 0), h-1))
+        if mode == 'klein':
+            # wraps left to right as a torus, and top to bottom with a twist
+            if y < 0 or y >= h:
+                y %= h
+                x = w - 1 - x
+            return (x % w, y)
+        return None
+    return m
+
+
+D = [(dx, dy) for dy in (-1, 0, 1) for dx in (-1, 0, 1) if (dx, dy) != (0, 0)]
+
+
+def step_bounded(mode, w, h, live):
+    m = mapper(mode, w, h)
+    cand = set()
+    for x, y in live:
+        for dy in (-1, 0, 1):
+            for dx in (-1, 0, 1):
+                if 0 <= x+dx < w and 0 <= y+dy < h:
+                    cand.add((x+dx, y+dy))
+    # cells on the edge can be born from cells across it
+    for x in range(w):
+        cand.add((x, 0))
+        cand.add((x, h-1))
+    for y in range(h):
+        cand.add((0, y))
+        cand.add((w-1, y))
+    new = set()
+    for x, y in cand:
+        n = 0
+        for dx, dy in D:
+            t = m(x+dx, y+dy)
+            if t is not None and t in live:
+                n += 1
+        if n == 3 or (n == 2 and (x, y) in live):
+            new.add((x, y))
+    return new
+
+
+def step_infinite(live):
+    counts = {}
+    for x, y in live:
+        for dx, dy in D:
+            k = (x+dx, y+dy)
+            counts[k] = counts.get(k, 0) + 1
+    return {c for c, n in counts.items() if n == 3 or (n == 2 and c in live)}
+
+
+out = sys.argv[1]
+for mode in ['dead', 'reflect', 'klein', 'infinite']:
+    # only the sizes TestBoundaries runs, as TestGol already covers 512x512 on the torus
+    for size in [16, 64]:
+        w, h, live = read_pgm('images/%dx%d.pgm' % (size, size))
+        for turn in range(1, 101):
+            live = step_infinite(live) if mode == 'infinite' else step_bounded(mode, w, h, live)
+            if turn in (1, 100):
+                # on the infinite plane only the part of it the image covers is saved
+                view = {(x, y) for x, y in live if 0 <= x < w and 0 <= y < h}
+                os.makedirs(os.path.join(out, mode), exist_ok=True)
+                write_pgm(os.path.join(out, mode, '%dx%dx%d.pgm' % (w, h, turn)), w, h, view)
+        print(mode, size, len(live), flush=True)
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"net/rpc"
+	"os/exec"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// distributedTests are the tests that run servers in the test process, which TestRace runs again with the race detector.
+const distributedTests = "TestBroker|TestFailover|TestBrokerFailover|TestAttach|TestShutdownSessions|TestBrokerShutdown|TestBrokerNoWorkers"
+
+// startWorker serves a GOL worker in the test process on a free port, as the worker program does.
+// Shutdown is closed once the worker has been told to shut down.
+func startWorker(t *testing.T) (listener *engine.Listener, shutdown chan struct{}) {
+	shutdown = make(chan struct{})
+	server := rpc.NewServer()
+	if err := server.Register(engine.NewGOLWorker(func() { close(shutdown) })); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := engine.Listen(server, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// startBroker serves a broker in the test process on a free port, with a worker of each of the given
+// capacities in its pool, as the broker program does. Shutdown is closed once the broker has been told
+// to shut down, and the workers have to be shut down by the caller, as the broker program does.
+func startBroker(t *testing.T, halo bool, capacities ...int) (listener *engine.Listener, broker *engine.Broker, workers []*engine.Listener, shutdown chan struct{}) {
+	shutdown = make(chan struct{})
+	broker = engine.NewBroker(halo, func() { close(shutdown) })
+	server := rpc.NewServer()
+	if err := server.RegisterName("GOLWorker", broker.Server); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("Broker", broker.Pool); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := engine.Listen(server, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, capacity := range capacities {
+		worker, _ := startWorker(t)
+		workers = append(workers, worker)
+		joinBroker(t, listener, worker, capacity)
+	}
+	return
+}
+
+// joinBroker registers the worker with the broker, as the worker program does when it is given one.
+func joinBroker(t *testing.T, broker, worker *engine.Listener, capacity int) {
+	client, err := rpc.Dial("tcp", broker.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	request := stubs.WorkerInfo{Address: worker.Addr().String(), Capacity: capacity}
+	if err := client.Call(string(stubs.RegisterWorker), request, new(stubs.Empty)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// killAll closes every listener and connection, so nothing is left serving after a test.
+func killAll(listeners ...*engine.Listener) {
+	for _, listener := range listeners {
+		listener.Kill()
+	}
+}
+
+// TestBroker runs the images through a broker with two workers of different capacities, so the strips
+// are different heights, both farming the strips out every turn and in halo exchange mode.
+func TestBroker(t *testing.T) {
+	for _, halo := range []bool{false, true} {
+		listener, _, workers, _ := startBroker(t, halo, 1, 3)
+		name := "broker"
+		if halo {
+			name = "halo"
+		}
+		testImages(t, name, "", gol.Params{Server: listener.Addr().String(), Threads: 4})
+		killAll(append(workers, listener)...)
+	}
+}
+
+// runAndKill runs p, pausing it part way through and killing victim as if it had crashed. The broker can't
+// notice that one of its workers has gone while it is paused, so it is resumed when resume is set. It returns
+// the cells alive at the end, and whether the controller reported that it was reconnecting.
+func runAndKill(t *testing.T, p gol.Params, victim *engine.Listener, resume bool) (cells []util.Cell, reconnected bool) {
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 1)
+	go gol.Run(p, events, keyPresses)
+	awaitState(t, events, gol.Executing)
+	keyPresses <- 'p'
+	if paused := awaitState(t, events, gol.Paused); paused.CompletedTurns >= p.Turns {
+		t.Fatal("the calculation finished before the worker could be killed")
+	}
+	victim.Kill()
+	if resume {
+		keyPresses <- 'p'
+	}
+
+	for event := range events {
+		switch e := event.(type) {
+		case gol.StateChange:
+			reconnected = reconnected || e.NewState == gol.Reconnecting
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	return
+}
+
+// TestFailover kills the worker a controller is using part way through, and checks that it carries on
+// with the next server it was given from the state it was last shown, and still ends up with the right result.
+func TestFailover(t *testing.T) {
+	first, _ := startWorker(t)
+	second, _ := startWorker(t)
+	defer killAll(first, second)
+
+	p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 100, Threads: 4}
+	p.Server = first.Addr().String() + "," + second.Addr().String()
+	cells, reconnected := runAndKill(t, p, first, false)
+	if !reconnected {
+		t.Error("no Reconnecting StateChange was sent")
+	}
+	assertEqualBoard(t, cells, readAliveCells("check/images/512x512x100.pgm", 512, 512), p)
+}
+
+// TestBrokerFailover kills one of a broker's workers part way through, and checks that the broker drops
+// it from the pool and carries on with the other, whether it farms out turns or hands out strips.
+func TestBrokerFailover(t *testing.T) {
+	for _, halo := range []bool{false, true} {
+		t.Run(fmt.Sprintf("halo=%t", halo), func(t *testing.T) {
+			listener, _, workers, _ := startBroker(t, halo, 1, 1)
+			defer killAll(append(workers, listener)...)
+
+			p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 100, Threads: 4, Server: listener.Addr().String()}
+			cells, _ := runAndKill(t, p, workers[0], true)
+			assertEqualBoard(t, cells, readAliveCells("check/images/512x512x100.pgm", 512, 512), p)
+
+			client, err := rpc.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			pool := new(stubs.WorkerListResponse)
+			if err := client.Call(string(stubs.ListWorkers), stubs.Empty{}, pool); err != nil {
+				t.Fatal(err)
+			}
+			if len(pool.Workers) != 1 || pool.Workers[0].Address != workers[1].Addr().String() {
+				t.Errorf("pool is %v, expected only %s", pool.Workers, workers[1].Addr())
+			}
+		})
+	}
+}
+
+// TestAttach pauses a calculation on a broker, attaches a second controller to it and resumes it from
+// there, and checks that both controllers end up with the right result.
+func TestAttach(t *testing.T) {
+	listener, _, workers, _ := startBroker(t, false, 1, 1)
+	defer killAll(append(workers, listener)...)
+
+	p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 100, Threads: 4, Server: listener.Addr().String()}
+	expectedAlive := readAliveCells("check/images/512x512x100.pgm", 512, 512)
+
+	first := make(chan gol.Event)
+	firstKeys := make(chan rune, 1)
+	go gol.Run(p, first, firstKeys)
+	awaitState(t, first, gol.Executing)
+	firstKeys <- 'p'
+	paused := awaitState(t, first, gol.Paused)
+	if paused.CompletedTurns >= p.Turns {
+		t.Fatal("the calculation finished before it could be paused")
+	}
+	firstCells := make(chan []util.Cell)
+	go func() { firstCells <- finalCells(first) }()
+
+	// the first session on a new broker is 1
+	attach := gol.Params{ImageWidth: 512, ImageHeight: 512, Threads: 4, Server: p.Server, Attach: true, Session: 1}
+	second := make(chan gol.Event)
+	secondKeys := make(chan rune, 1)
+	go gol.Run(attach, second, secondKeys)
+	if state := awaitState(t, second, gol.Paused); state.CompletedTurns != paused.CompletedTurns {
+		t.Errorf("attached at turn %d, expected the turn it was paused at, %d", state.CompletedTurns, paused.CompletedTurns)
+	}
+	secondKeys <- 'p'
+
+	assertEqualBoard(t, finalCells(second), expectedAlive, p)
+	assertEqualBoard(t, <-firstCells, expectedAlive, p)
+}
+
+// closed is whether shutdown is closed within a second, which is plenty for a server to stop once it has replied.
+func closed(shutdown chan struct{}) bool {
+	select {
+	case <-shutdown:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+// TestShutdownSessions presses 'k' on one of two sessions on a worker, and checks that only that session
+// is stopped and the worker is left running the other, until 'k' is pressed on that one too.
+func TestShutdownSessions(t *testing.T) {
+	worker, shutdown := startWorker(t)
+	defer killAll(worker)
+
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 10000000, Threads: 4, Server: worker.Addr().String()}
+	running := make(chan gol.Event)
+	runningKeys := make(chan rune, 1)
+	go gol.Run(p, running, runningKeys)
+	awaitState(t, running, gol.Executing)
+
+	killed := make(chan gol.Event)
+	killedKeys := make(chan rune, 1)
+	go gol.Run(p, killed, killedKeys)
+	awaitState(t, killed, gol.Executing)
+	killedKeys <- 'k'
+	finalCells(killed)
+	if closed(shutdown) {
+		t.Fatal("the worker shut down while another session was running")
+	}
+
+	// the GUI may be behind the worker, so pausing finds out where the worker is, to check it moves on from there
+	runningKeys <- 'p'
+	at := awaitState(t, running, gol.Paused).CompletedTurns
+	runningKeys <- 'p'
+	for event := range running {
+		if e, ok := event.(gol.TurnComplete); ok && e.CompletedTurns > at {
+			break
+		}
+	}
+
+	runningKeys <- 'k'
+	finalCells(running)
+	if !closed(shutdown) {
+		t.Error("the worker didn't shut down once the last session was killed")
+	}
+}
+
+// TestBrokerShutdown presses 'k' on a broker's only session, and checks that the broker shuts down and
+// then takes its workers down with it, as the broker program does.
+func TestBrokerShutdown(t *testing.T) {
+	listener, broker, _, shutdown := startBroker(t, false)
+	defer killAll(listener)
+	worker, workerShutdown := startWorker(t)
+	defer killAll(worker)
+	joinBroker(t, listener, worker, 1)
+
+	keyPresses := make(chan rune, 1)
+	events := make(chan gol.Event)
+	go gol.Run(gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 10000000, Threads: 4, Server: listener.Addr().String()}, events, keyPresses)
+	awaitState(t, events, gol.Executing)
+	keyPresses <- 'k'
+	finalCells(events)
+	if !closed(shutdown) {
+		t.Fatal("the broker didn't shut down")
+	}
+
+	broker.ShutdownWorkers()
+	if !closed(workerShutdown) {
+		t.Error("the worker wasn't shut down with the broker")
+	}
+}
+
+// TestBrokerNoWorkers runs a calculation on a broker with no workers, and checks that it is reported as a
+// failure, with no final turn or image, rather than as if the world had finished.
+func TestBrokerNoWorkers(t *testing.T) {
+	listener, _, _, _ := startBroker(t, false)
+	defer killAll(listener)
+
+	events := make(chan gol.Event)
+	go gol.Run(gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4, Server: listener.Addr().String()}, events, nil)
+	var last gol.Event
+	for event := range events {
+		switch event.(type) {
+		case gol.FinalTurnComplete, gol.ImageOutputComplete:
+			t.Errorf("the failed calculation sent a %T", event)
+		}
+		last = event
+	}
+	if state, ok := last.(gol.StateChange); !ok || state.NewState != gol.Quitting {
+		t.Errorf("the last event was %v, expected a StateChange to Quitting", last)
+	}
+}
+
+// TestRace runs the distributed tests again with the race detector, as every connection has goroutines on
+// both sides of it sharing a simulation. It is skipped if the tests are already being run with -race, or with -short.
+func TestRace(t *testing.T) {
+	if raceEnabled || testing.Short() {
+		t.Skip("the distributed tests are already run with the race detector, or -short was given")
+	}
+	out, err := exec.Command("go", "test", "-race", "-count=1", "-run", "^("+distributedTests+")$", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
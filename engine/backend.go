@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"uk.ac.bris.cs/gameoflife/golUtils"
+)
+
+// Backend calculates the turns of a Simulation. LocalBackend runs one of the golUtils engines in-process,
+// and a broker's WorkerPool farms the turns out to its workers.
+type Backend interface {
+	// Step advances the world by at least one turn and by at most turns, and returns how many it advanced,
+	// which can be some even when it fails to bring the world up to date.
+	// World only has to be brought up to date when view is set, so a backend whose world is kept elsewhere
+	// only fetches it when someone is waiting to see it.
+	Step(turns int, view bool) (int, error)
+	// Sync brings World up to date with the last step.
+	Sync() error
+	// World returns the world as of the last step that was viewed or synced, and where the image is in it.
+	// Backends never change a world they have returned, so it can be shared.
+	World() (golUtils.World, golUtils.CoOrds)
+	// AliveCells returns how many cells are alive after the last step.
+	AliveCells() int
+	// Release frees anything held for stepping once the calculation is over. Step takes it again if the
+	// calculation carries on.
+	Release()
+}
+
+// NewBackend makes a Backend for a world, where origin is where the image's top left corner is in it.
+type NewBackend func(p golUtils.Params, w golUtils.World, origin golUtils.CoOrds) (Backend, error)
+
+// localBackend runs a golUtils engine, whose world is always up to date.
+type localBackend struct {
+	golUtils.Engine
+}
+
+// LocalBackend runs the world in-process, with the engine named in p.
+func LocalBackend(p golUtils.Params, w golUtils.World, origin golUtils.CoOrds) (Backend, error) {
+	engine, err := golUtils.NewEngine(p, w, origin)
+	if err != nil {
+		return nil, err
+	}
+	return localBackend{engine}, nil
+}
+
+func (b localBackend) Step(turns int, view bool) (int, error) {
+	return b.Engine.Step(turns), nil
+}
+
+func (b localBackend) Sync() error {
+	return nil
+}
+
+func (b localBackend) Release() {}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"net/rpc"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Broker splits each session's world into horizontal strips and farms them out to the GOL workers in
+// its pool. Server answers the same calls as a GOL worker, so it is registered under the GOLWorker name
+// and the distributor can use the same stubs for both, and Pool is registered under the Broker name.
+type Broker struct {
+	Server *Server
+	Pool   *WorkerPool
+}
+
+// NewBroker makes a broker with no workers. With haloExchange the workers keep their strips and swap
+// edge rows with each other directly, rather than being sent their strips every turn.
+// Only the dense engine can be split between workers, so sessions asking for another engine are refused
+// as Unsupported. Shutdown stops every session and then calls shutdown.
+func NewBroker(haloExchange bool, shutdown func()) *Broker {
+	pool := &WorkerPool{}
+	newBackend := func(p golUtils.Params, w golUtils.World, origin golUtils.CoOrds) (Backend, error) {
+		// only the dense engine can be split into strips
+		if p.Engine != "" && p.Engine != golUtils.EngineNames[0] {
+			return nil, stubs.Unsupported
+		}
+		// strips can't grow, so the infinite plane is always calculated centrally
+		if haloExchange && p.Boundary != golUtils.Infinite {
+			return &haloBackend{pool: pool, params: p, world: w, stripKey: rand.Int(), aliveCells: golUtils.CountCells(w)}, nil
+		}
+		return &farmBackend{pool: pool, params: p, world: w, origin: origin}, nil
+	}
+	return &Broker{Server: NewServer(newBackend, shutdown), Pool: pool}
+}
+
+// ShutdownWorkers tells every worker in the pool to shut down, once the broker's sessions have stopped.
+func (b *Broker) ShutdownWorkers() {
+	b.Pool.shutdownWorkers()
+}
+
+// section returns the rows [startY, endY) of the world, plus the halo row above and below.
+// The rows are shared with the world rather than copied, as worlds are never modified in place.
+func section(w golUtils.World, p golUtils.Params, startY, endY int) golUtils.World {
+	rows := make(golUtils.World, 0, endY-startY+2)
+	rows = append(rows, golUtils.RowAt(p, w, startY-1))
+	rows = append(rows, w[startY:endY]...)
+	rows = append(rows, golUtils.RowAt(p, w, endY))
+	return rows
+}
+
+// stripBounds splits the world's rows between the workers in proportion to their capacity.
+// Worker i gets the rows [bounds[i], bounds[i+1]), which can be empty for a small capacity.
+func stripBounds(workers []*poolWorker, height int) []int {
+	totalCapacity := 0
+	for _, worker := range workers {
+		totalCapacity += worker.capacity
+	}
+
+	bounds := make([]int, len(workers)+1)
+	capacity := 0
+	for i, worker := range workers {
+		capacity += worker.capacity
+		bounds[i+1] = capacity * height / totalCapacity
+	}
+	return bounds
+}
+
+// calculateNextState sends one strip to each worker and stitches the returned strips back together.
+// Strip heights are proportional to each worker's capacity. If a worker fails it is dropped from the
+// pool and the turn is retried with the workers that are left.
+func (wp *WorkerPool) calculateNextState(p golUtils.Params, w golUtils.World) (golUtils.World, error) {
+	for {
+		workers := wp.snapshot()
+		if len(workers) == 0 {
+			return nil, stubs.NoWorkers
+		}
+
+		bounds := stripBounds(workers, p.ImageHeight)
+		calls := make([]*rpc.Call, len(workers))
+		responses := make([]*stubs.SectionResponse, len(workers))
+		for i, worker := range workers {
+			if bounds[i+1] == bounds[i] {
+				continue
+			}
+			request := stubs.SectionRequest{Params: p, Section: golUtils.PackWorld(section(w, p, bounds[i], bounds[i+1]))}
+			responses[i] = new(stubs.SectionResponse)
+			calls[i] = worker.client.Go(string(stubs.CalculateSection), request, responses[i], nil)
+		}
+
+		newWorld := make(golUtils.World, 0, p.ImageHeight)
+		var failed *poolWorker
+		for i, call := range calls {
+			if call == nil {
+				continue
+			}
+			<-call.Done
+			if failed != nil {
+				continue
+			}
+			if call.Error != nil {
+				failed = workers[i]
+				continue
+			}
+			rows, err := responses[i].Section.Unpack()
+			if err != nil || len(rows) != bounds[i+1]-bounds[i] {
+				failed = workers[i]
+				continue
+			}
+			newWorld = append(newWorld, rows...)
+		}
+
+		if failed == nil {
+			return newWorld, nil
+		}
+		fmt.Printf("Worker %s failed, dropping it from the pool\n", failed.address)
+		wp.remove(failed.address)
+	}
+}
+
+// farmBackend sends every worker its strip each turn and stitches the results back together, so the
+// whole world is always at the broker. On the infinite plane the world is grown before each turn, so
+// the strips change size as it grows.
+type farmBackend struct {
+	pool   *WorkerPool
+	params golUtils.Params
+	world  golUtils.World
+	origin golUtils.CoOrds
+}
+
+func (b *farmBackend) Step(turns int, view bool) (int, error) {
+	params := b.params
+	world, origin := b.world, b.origin
+	if params.Boundary == golUtils.Infinite {
+		world, origin = golUtils.Grow(world, origin)
+		params.ImageHeight = len(world)
+		params.ImageWidth = len(world[0])
+	}
+
+	// the stitched world is a fresh slice each turn, so it can be shared without copying
+	newWorld, err := b.pool.calculateNextState(params, world)
+	if err != nil {
+		return 0, err
+	}
+	b.world, b.origin = newWorld, origin
+	return 1, nil
+}
+
+func (b *farmBackend) Sync() error {
+	return nil
+}
+
+func (b *farmBackend) World() (golUtils.World, golUtils.CoOrds) {
+	return b.world, b.origin
+}
+
+func (b *farmBackend) AliveCells() int {
+	return golUtils.CountCells(b.world)
+}
+
+func (b *farmBackend) Release() {}
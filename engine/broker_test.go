@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestBrokerEngines checks that a broker only takes worlds for the dense engine, which is the only one
+// that can be split into strips, and refuses the others as Unsupported.
+func TestBrokerEngines(t *testing.T) {
+	for _, halo := range []bool{false, true} {
+		broker := NewBroker(halo, func() {})
+		for _, engine := range append([]string{""}, golUtils.EngineNames...) {
+			req := stubs.WorldRequest{
+				Params: golUtils.Params{ImageWidth: 16, ImageHeight: 16, Engine: engine},
+				World:  golUtils.PackWorld(golUtils.MakeWorld(16, 16)),
+			}
+			err := broker.Server.ReceiveWorldData(req, new(stubs.SessionResponse))
+			dense := engine == "" || engine == golUtils.EngineNames[0]
+			if dense && err != nil {
+				t.Errorf("halo %v: the %q engine was refused: %v", halo, engine, err)
+			} else if !dense && err != stubs.Unsupported {
+				t.Errorf("halo %v: the %q engine gave %v, expected %v", halo, engine, err, stubs.Unsupported)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"errors"
+	"net/rpc"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// CallTimeout is how long a call that the server answers straight away is given. A server that has gone
+// without the connection being closed would otherwise never answer, so a timeout is taken as the connection
+// being lost. Run and Await wait for the calculation to finish, so they are left without one.
+const CallTimeout = 10 * time.Second
+
+// ErrTimeout is returned by calls the server didn't answer within CallTimeout.
+var ErrTimeout = errors.New("server didn't reply in time")
+
+// Client runs a calculation on a GOL worker or broker, as one of the sessions it hosts.
+type Client struct {
+	client  *rpc.Client
+	session int
+}
+
+// NewClient uses the session with the given ID, which Load replaces with a new one.
+func NewClient(client *rpc.Client, session int) *Client {
+	return &Client{client: client, session: session}
+}
+
+// Session is the ID of the session on the server.
+func (c *Client) Session() int {
+	return c.session
+}
+
+func (c *Client) request() stubs.SessionRequest {
+	return stubs.SessionRequest{Session: c.session}
+}
+
+// Call makes a call that the server should answer straight away, giving up after CallTimeout.
+// The response mustn't be used if there is an error, as a late reply may still be written to it.
+func Call(client *rpc.Client, method stubs.Stub, request interface{}, response interface{}) error {
+	call := client.Go(string(method), request, response, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(CallTimeout):
+		return ErrTimeout
+	}
+}
+
+func (c *Client) call(method stubs.Stub, request interface{}, response interface{}) error {
+	return Call(c.client, method, request, response)
+}
+
+// Load starts a new session on the server with the world.
+func (c *Client) Load(p golUtils.Params, w golUtils.World, origin golUtils.CoOrds, turn int) error {
+	request := stubs.WorldRequest{Params: p, World: golUtils.PackWorld(w), Origin: origin, Turn: turn}
+	response := new(stubs.SessionResponse)
+	if err := c.call(stubs.SendWorldData, request, response); err != nil {
+		return err
+	}
+	c.session = response.Session
+	return nil
+}
+
+func (c *Client) Run(turns int) (int, error) {
+	response := new(stubs.TurnResponse)
+	err := c.client.Call(string(stubs.CalculateNTurns), stubs.TurnsRequest{Session: c.session, Turns: turns}, response)
+	return response.CompletedTurns, err
+}
+
+func (c *Client) Snapshot() (golUtils.World, golUtils.CoOrds, int, error) {
+	state := new(stubs.StateResponse)
+	if err := c.call(stubs.SendCurrentState, c.request(), state); err != nil {
+		return nil, golUtils.CoOrds{}, 0, err
+	}
+	world, err := state.World.Unpack()
+	return world, state.Origin, state.CompletedTurns, err
+}
+
+func (c *Client) AliveCells() (int, int, error) {
+	cellCount := new(stubs.CellCountResponse)
+	if err := c.call(stubs.SendCellCount, c.request(), cellCount); err != nil {
+		return 0, 0, err
+	}
+	return cellCount.CompletedTurns, cellCount.AliveCells, nil
+}
+
+func (c *Client) Flips(since int, paused bool) (stubs.FlipsResponse, error) {
+	flips := new(stubs.FlipsResponse)
+	if err := c.call(stubs.SendFlips, stubs.FlipsRequest{Session: c.session, Since: since, Paused: paused}, flips); err != nil {
+		return stubs.FlipsResponse{}, err
+	}
+	return *flips, nil
+}
+
+func (c *Client) Pause() error {
+	return c.call(stubs.PauseCalculations, c.request(), new(stubs.Empty))
+}
+
+func (c *Client) Resume() error {
+	return c.call(stubs.UnPauseCalculations, c.request(), new(stubs.Empty))
+}
+
+func (c *Client) Stop() error {
+	return c.call(stubs.StopCalculations, c.request(), new(stubs.Empty))
+}
+
+// Close frees the session on the server, once every other controller using it has closed it too.
+func (c *Client) Close() error {
+	return c.call(stubs.CloseSession, c.request(), new(stubs.Empty))
+}
+
+// Attach joins the session as another of its controllers, and asks the server what it is running.
+func (c *Client) Attach() (stubs.StatusResponse, error) {
+	status := new(stubs.StatusResponse)
+	if err := c.call(stubs.AttachSession, c.request(), status); err != nil {
+		return stubs.StatusResponse{}, err
+	}
+	return *status, nil
+}
+
+// Detach leaves the session running on the server, for a controller to attach to later.
+func (c *Client) Detach() error {
+	return c.call(stubs.DetachSession, c.request(), new(stubs.Empty))
+}
+
+// Await blocks until the session's calculation finishes, in place of Run for a controller
+// that attaches to a calculation another controller started.
+func (c *Client) Await() (int, error) {
+	response := new(stubs.TurnResponse)
+	err := c.client.Call(string(stubs.AwaitCalculation), c.request(), response)
+	return response.CompletedTurns, err
+}
@@ -0,0 +1,35 @@
+// Package engine runs Game of Life calculations. A calculation can be run in-process by a Simulation,
+// or on a GOL worker or broker through a Client, and the distributor drives both through Engine.
+// GOL workers and brokers serve their Simulations with a Server, and a broker's backends farm
+// the turns out to the workers in its pool.
+package engine
+
+import (
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Engine is a calculation that can be loaded with a world, run, watched and paused.
+type Engine interface {
+	// Load gives the engine the world to calculate, along with the number of turns already
+	// completed, so a calculation can be resumed. Origin is where the image's top left corner is in the world.
+	Load(p golUtils.Params, w golUtils.World, origin golUtils.CoOrds, turn int) error
+	// Run calculates until the given number of turns have been completed or Stop is called,
+	// and returns the number of completed turns. It can be called again to carry on further.
+	Run(turns int) (int, error)
+	// Snapshot returns the current world, where the image is in it and the number of completed turns.
+	Snapshot() (golUtils.World, golUtils.CoOrds, int, error)
+	// AliveCells returns the number of completed turns and how many cells were alive after them.
+	AliveCells() (int, int, error)
+	// Flips waits a short while for a turn after since to be completed, or for the calculation to be paused
+	// or resumed, and returns the cells of the image that have changed since the watcher was last sent them,
+	// along with whether it is paused. A since of -1 starts watching, and paused is whether it was last paused.
+	Flips(since int, paused bool) (stubs.FlipsResponse, error)
+
+	Pause() error
+	Resume() error
+	// Stop makes Run return once the turn it is calculating is done.
+	Stop() error
+	// Close stops the calculation and frees it.
+	Close() error
+}
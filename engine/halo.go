@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"net/rpc"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// stripState holds the strip of the world a worker owns in halo exchange mode.
+type stripState struct {
+	lock      sync.Mutex
+	haloReady *sync.Cond
+	closed    bool
+
+	params golUtils.Params
+	strip  golUtils.World
+	turn   int
+	// The strip as the broker was last sent it, and the turn it was at
+	sent     golUtils.World
+	sentTurn int
+
+	// Whether the strip is at the top or bottom of the world
+	first bool
+	last  bool
+
+	above *rpc.Client
+	below *rpc.Client
+
+	// Halos are kept by turn, as a neighbour can send its rows before this worker is told to step
+	halosAbove map[int][]byte
+	halosBelow map[int][]byte
+}
+
+// close releases the neighbour connections and wakes up any step waiting for a halo.
+func (s *stripState) close() {
+	s.lock.Lock()
+	s.closed = true
+	s.haloReady.Broadcast()
+	s.lock.Unlock()
+	s.above.Close()
+	s.below.Close()
+}
+
+// changes lists what has changed since the broker was sent the strip at turn since, and remembers the
+// strip as sent. s.lock must be held.
+func (s *stripState) changes(since int) (changes stubs.StripFlips) {
+	old := s.sent
+	if s.sentTurn != since {
+		old = nil
+		changes.Reset = true
+	}
+	changes.Flips = golUtils.Diff(old, s.strip)
+	s.sent = s.strip
+	s.sentTurn = s.turn
+	return
+}
+
+func (g *GOLWorker) getStrip(session int) (*stripState, error) {
+	g.accessStrips.Lock()
+	defer g.accessStrips.Unlock()
+	s, ok := g.strips[session]
+	if !ok {
+		return nil, stubs.NoSession
+	}
+	return s, nil
+}
+
+// releaseStrips closes every strip, for when the worker is shutting down.
+func (g *GOLWorker) releaseStrips() {
+	g.accessStrips.Lock()
+	strips := g.strips
+	g.strips = make(map[int]*stripState)
+	g.accessStrips.Unlock()
+	for _, s := range strips {
+		s.close()
+	}
+}
+
+func (g *GOLWorker) LoadStrip(req stubs.StripRequest, res *stubs.Empty) (err error) {
+	strip, err := req.Strip.Unpack()
+	if err != nil || req.Strip.Height == 0 || req.Strip.Width != req.Params.ImageWidth {
+		err = stubs.BadRequest
+		return
+	}
+
+	above, err := rpc.Dial("tcp", req.Above)
+	if err != nil {
+		return
+	}
+	below, err := rpc.Dial("tcp", req.Below)
+	if err != nil {
+		above.Close()
+		return
+	}
+
+	s := &stripState{
+		params:     req.Params,
+		strip:      strip,
+		turn:       req.Turn,
+		sent:       strip,
+		sentTurn:   req.Turn,
+		first:      req.First,
+		last:       req.Last,
+		above:      above,
+		below:      below,
+		halosAbove: make(map[int][]byte),
+		halosBelow: make(map[int][]byte),
+	}
+	s.haloReady = sync.NewCond(&s.lock)
+
+	g.accessStrips.Lock()
+	old := g.strips[req.Session]
+	g.strips[req.Session] = s
+	g.accessStrips.Unlock()
+	if old != nil {
+		old.close()
+	}
+	return
+}
+
+// ReleaseStrip closes a strip once the broker has collected it.
+func (g *GOLWorker) ReleaseStrip(req stubs.SessionRequest, res *stubs.Empty) (err error) {
+	g.accessStrips.Lock()
+	s, ok := g.strips[req.Session]
+	delete(g.strips, req.Session)
+	g.accessStrips.Unlock()
+	if !ok {
+		err = stubs.NoSession
+		return
+	}
+
+	s.close()
+	return
+}
+
+func (g *GOLWorker) ReceiveHalo(req stubs.HaloRequest, res *stubs.Empty) (err error) {
+	s, err := g.getStrip(req.Session)
+	if err != nil {
+		return
+	}
+	row, err := req.Row.Unpack()
+	if err != nil || len(row) != 1 {
+		err = stubs.BadRequest
+		return
+	}
+
+	s.lock.Lock()
+	if req.FromAbove {
+		s.halosAbove[req.Turn] = row[0]
+	} else {
+		s.halosBelow[req.Turn] = row[0]
+	}
+	s.haloReady.Broadcast()
+	s.lock.Unlock()
+	return
+}
+
+// edgeHalo gives the halo row from across the top or bottom edge of the world. Received is the row
+// sent by the worker across the edge, which is only right as it is on a torus, and own is the strip's
+// row on the edge.
+func edgeHalo(p golUtils.Params, received, own []byte) []byte {
+	if p.Boundary == golUtils.Reflect {
+		return own
+	}
+	return golUtils.RowAt(p, golUtils.World{received}, -1)
+}
+
+// StepStrip swaps edge rows with the neighbouring workers, then calculates the next state of the strip.
+// When the broker is viewing the turn, the cells that have changed are sent back with it.
+func (g *GOLWorker) StepStrip(req stubs.StepRequest, res *stubs.StepResponse) (err error) {
+	s, err := g.getStrip(req.Session)
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	if req.Turn != s.turn {
+		s.lock.Unlock()
+		err = stubs.BadRequest
+		return
+	}
+	top := golUtils.World{s.strip[0]}
+	bottom := golUtils.World{s.strip[len(s.strip)-1]}
+	s.lock.Unlock()
+
+	// our top row is the bottom halo of the strip above, and our bottom row the top halo of the strip below
+	topCall := s.above.Go(string(stubs.ReceiveHalo), stubs.HaloRequest{Session: req.Session, Turn: req.Turn, FromAbove: false, Row: golUtils.PackWorld(top)}, new(stubs.Empty), nil)
+	bottomCall := s.below.Go(string(stubs.ReceiveHalo), stubs.HaloRequest{Session: req.Session, Turn: req.Turn, FromAbove: true, Row: golUtils.PackWorld(bottom)}, new(stubs.Empty), nil)
+	<-topCall.Done
+	<-bottomCall.Done
+	if topCall.Error != nil {
+		return topCall.Error
+	}
+	if bottomCall.Error != nil {
+		return bottomCall.Error
+	}
+
+	s.lock.Lock()
+	for !s.closed && (s.halosAbove[req.Turn] == nil || s.halosBelow[req.Turn] == nil) {
+		s.haloReady.Wait()
+	}
+	if s.closed {
+		s.lock.Unlock()
+		err = stubs.NoWorld
+		return
+	}
+	haloAbove := s.halosAbove[req.Turn]
+	if s.first {
+		haloAbove = edgeHalo(s.params, haloAbove, s.strip[0])
+	}
+	haloBelow := s.halosBelow[req.Turn]
+	if s.last {
+		haloBelow = edgeHalo(s.params, haloBelow, s.strip[len(s.strip)-1])
+	}
+	section := make(golUtils.World, 0, len(s.strip)+2)
+	section = append(section, haloAbove)
+	section = append(section, s.strip...)
+	section = append(section, haloBelow)
+	delete(s.halosAbove, req.Turn)
+	delete(s.halosBelow, req.Turn)
+	s.lock.Unlock()
+
+	params := s.params
+	params.ImageHeight = len(section)
+	newStrip := golUtils.CalculateNextState(params, section, golUtils.CoOrds{X: 0, Y: 1}, golUtils.CoOrds{X: params.ImageWidth, Y: params.ImageHeight - 1})
+
+	s.lock.Lock()
+	s.strip = newStrip
+	s.turn++
+	if req.View {
+		res.Changes = s.changes(req.Since)
+	}
+	s.lock.Unlock()
+
+	res.AliveCells = golUtils.CountCells(newStrip)
+	return
+}
+
+// SendStrip sends the broker what has changed in the strip since it was last sent it.
+func (g *GOLWorker) SendStrip(req stubs.StripFlipsRequest, res *stubs.StripFlipsResponse) (err error) {
+	s, err := g.getStrip(req.Session)
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	res.CompletedTurns = s.turn
+	res.Changes = s.changes(req.Since)
+	s.lock.Unlock()
+	return
+}
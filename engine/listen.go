@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"sync"
+)
+
+// Listener serves RPC calls on the connections it accepts. It counts the calls that haven't been
+// replied to yet, so that a server shutting down can send every reply, including the one to
+// Shutdown itself, before it exits.
+type Listener struct {
+	listener net.Listener
+	server   *rpc.Server
+
+	lock  sync.Mutex
+	idle  *sync.Cond
+	calls int
+	conns map[io.Closer]bool
+}
+
+// Listen starts serving the calls registered with server on address, e.g. ":8030".
+func Listen(server *rpc.Server, address string) (*Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{listener: listener, server: server, conns: make(map[io.Closer]bool)}
+	l.idle = sync.NewCond(&l.lock)
+	go l.accept()
+	return l, nil
+}
+
+// Addr is the address the listener is listening on.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *Listener) accept() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		l.lock.Lock()
+		l.conns[conn] = true
+		l.lock.Unlock()
+		go l.server.ServeCodec(newServerCodec(conn, l))
+	}
+}
+
+// Close stops taking new connections and waits for the calls in progress to be replied to,
+// then closes every connection.
+func (l *Listener) Close() {
+	l.listener.Close()
+	l.lock.Lock()
+	for l.calls > 0 {
+		l.idle.Wait()
+	}
+	l.lock.Unlock()
+	l.Kill()
+}
+
+// Kill closes the listener and every connection straight away, as if the server had crashed.
+func (l *Listener) Kill() {
+	l.listener.Close()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = make(map[io.Closer]bool)
+}
+
+func (l *Listener) begin() {
+	l.lock.Lock()
+	l.calls++
+	l.lock.Unlock()
+}
+
+func (l *Listener) end() {
+	l.lock.Lock()
+	if l.calls--; l.calls == 0 {
+		l.idle.Broadcast()
+	}
+	l.lock.Unlock()
+}
+
+func (l *Listener) closed(conn io.Closer) {
+	l.lock.Lock()
+	delete(l.conns, conn)
+	l.lock.Unlock()
+}
+
+// serverCodec is the gob codec net/rpc uses, which it doesn't export, telling the listener when
+// each call has been read and when it has been replied to. net/rpc replies to every call whose
+// header it reads, even ones it can't make.
+type serverCodec struct {
+	rwc      io.ReadWriteCloser
+	dec      *gob.Decoder
+	enc      *gob.Encoder
+	encBuf   *bufio.Writer
+	listener *Listener
+	closed   bool
+}
+
+func newServerCodec(conn io.ReadWriteCloser, listener *Listener) *serverCodec {
+	buf := bufio.NewWriter(conn)
+	return &serverCodec{
+		rwc:      conn,
+		dec:      gob.NewDecoder(conn),
+		enc:      gob.NewEncoder(buf),
+		encBuf:   buf,
+		listener: listener,
+	}
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.dec.Decode(r)
+	if err == nil {
+		c.listener.begin()
+	}
+	return err
+}
+
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	defer c.listener.end()
+	if err = c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			// gob couldn't encode the header, which shouldn't happen, so the connection is broken
+			log.Println("rpc: gob error encoding response:", err)
+			c.Close()
+		}
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			log.Println("rpc: gob error encoding body:", err)
+			c.Close()
+		}
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *serverCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.listener.closed(c.rwc)
+	return c.rwc.Close()
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"fmt"
+	"net/rpc"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// poolWorker is a GOL worker that has registered itself with the broker.
+type poolWorker struct {
+	address  string
+	capacity int
+	client   *rpc.Client
+}
+
+// WorkerPool keeps track of the GOL workers that have registered with the broker.
+// Workers can join and leave at any time, so the broker takes a snapshot of the pool every turn.
+// Only its RPC methods are exported, so it can be registered with net/rpc.
+type WorkerPool struct {
+	lock    sync.Mutex
+	workers []*poolWorker
+}
+
+// remove takes a worker out of the pool and closes its connection.
+func (wp *WorkerPool) remove(address string) bool {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	for i, worker := range wp.workers {
+		if worker.address == address {
+			worker.client.Close()
+			wp.workers = append(wp.workers[:i], wp.workers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// shutdownWorkers tells every worker in the pool to shut down and waits for them to reply. The broker has no
+// session of its own on the workers, so a worker also running sessions for controllers is left running.
+func (wp *WorkerPool) shutdownWorkers() {
+	workers := wp.snapshot()
+	calls := make([]*rpc.Call, len(workers))
+	for i, worker := range workers {
+		calls[i] = worker.client.Go(string(stubs.Shutdown), stubs.SessionRequest{}, new(stubs.Empty), nil)
+	}
+	for i, call := range calls {
+		<-call.Done
+		if stubs.CodeOf(call.Error) == stubs.Busy {
+			fmt.Printf("Worker %s is running other sessions, leaving it running\n", workers[i].address)
+		} else {
+			fmt.Printf("Worker %s shut down\n", workers[i].address)
+		}
+		wp.remove(workers[i].address)
+	}
+}
+
+func (wp *WorkerPool) snapshot() []*poolWorker {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	workers := make([]*poolWorker, len(wp.workers))
+	copy(workers, wp.workers)
+	return workers
+}
+
+func (wp *WorkerPool) RegisterWorker(req stubs.WorkerInfo, res *stubs.Empty) (err error) {
+	if req.Address == "" || req.Capacity < 1 {
+		err = stubs.BadRequest
+		return
+	}
+
+	client, err := rpc.Dial("tcp", req.Address)
+	if err != nil {
+		return
+	}
+
+	// a worker that restarts re-registers under the same address, so drop the stale connection
+	wp.remove(req.Address)
+
+	wp.lock.Lock()
+	wp.workers = append(wp.workers, &poolWorker{address: req.Address, capacity: req.Capacity, client: client})
+	fmt.Printf("Worker %s joined with capacity %d, %d workers in pool\n", req.Address, req.Capacity, len(wp.workers))
+	wp.lock.Unlock()
+	return
+}
+
+func (wp *WorkerPool) DeregisterWorker(req stubs.WorkerInfo, res *stubs.Empty) (err error) {
+	if !wp.remove(req.Address) {
+		err = stubs.NotRegistered
+		return
+	}
+
+	fmt.Printf("Worker %s left the pool\n", req.Address)
+	return
+}
+
+func (wp *WorkerPool) ListWorkers(req stubs.Empty, res *stubs.WorkerListResponse) (err error) {
+	for _, worker := range wp.snapshot() {
+		res.Workers = append(res.Workers, stubs.WorkerInfo{Address: worker.address, Capacity: worker.capacity})
+	}
+	return
+}
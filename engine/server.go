@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Server answers the GOL worker calls, hosting independent simulations identified by session IDs.
+// Only its RPC methods are exported, so it can be registered with net/rpc, or embedded in a type that is.
+type Server struct {
+	accessSessions sync.Mutex
+	sessions       map[int]*Simulation
+	nextSession    int
+	// How many controllers are using each session, which is only closed once they all have
+	controllers map[int]int
+	newBackend  NewBackend
+
+	// Called once every simulation has stopped after a Shutdown that nobody else's session was running for
+	shutdown     func()
+	shutdownOnce sync.Once
+}
+
+// NewServer makes a server with no sessions, whose simulations are run by backends from newBackend.
+// Shutdown stops the caller's session, and when no others are running stops them all and then calls shutdown.
+func NewServer(newBackend NewBackend, shutdown func()) *Server {
+	return &Server{sessions: make(map[int]*Simulation), controllers: make(map[int]int), newBackend: newBackend, shutdown: shutdown}
+}
+
+func (s *Server) getSession(session int) (*Simulation, error) {
+	s.accessSessions.Lock()
+	defer s.accessSessions.Unlock()
+	sim, ok := s.sessions[session]
+	if !ok {
+		return nil, stubs.NoSession
+	}
+	return sim, nil
+}
+
+func (s *Server) PauseCalculations(req stubs.SessionRequest, res *stubs.Empty) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+
+	fmt.Println("Pausing calculations!")
+	return sim.Pause()
+}
+
+func (s *Server) UnPauseCalculations(req stubs.SessionRequest, res *stubs.Empty) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+
+	fmt.Println("Unpausing calculations!")
+	return sim.Resume()
+}
+
+func (s *Server) StopCalculations(req stubs.SessionRequest, res *stubs.Empty) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+
+	fmt.Println("Stopping calculations!")
+	return sim.Stop()
+}
+
+func (s *Server) SendCellCount(req stubs.SessionRequest, res *stubs.CellCountResponse) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+	fmt.Println("Recieved request for cell count!")
+
+	res.CompletedTurns, res.AliveCells, err = sim.AliveCells()
+	fmt.Printf("a TURN %d, CELLS %d\n", res.CompletedTurns, res.AliveCells)
+	return
+}
+
+func (s *Server) SendTurnCount(req stubs.SessionRequest, res *stubs.TurnResponse) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+	fmt.Println("Recieved request for turn count!")
+
+	res.CompletedTurns = sim.Turn()
+	return
+}
+
+func (s *Server) SendCurrent(req stubs.SessionRequest, res *stubs.StateResponse) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+	fmt.Println("Recieved request for current state!")
+
+	currentWorld, origin, turn, err := sim.Snapshot()
+	if err != nil {
+		return
+	}
+	res.CompletedTurns = turn
+	res.World = golUtils.PackWorld(currentWorld)
+	res.Origin = origin
+	return
+}
+
+// SendFlips streams the cells that change to a controller, which calls it again as soon as it has shown
+// each response. It waits for a new turn first, so the controller is sent each turn as it completes.
+func (s *Server) SendFlips(req stubs.FlipsRequest, res *stubs.FlipsResponse) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+
+	*res, err = sim.Flips(req.Since, req.Paused)
+	return
+}
+
+func (s *Server) CalculateForTurns(req stubs.TurnsRequest, res *stubs.TurnResponse) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+	fmt.Printf("received request to calculate up to turn %d!\n", req.Turns)
+
+	res.CompletedTurns, err = sim.Run(req.Turns)
+	return
+}
+
+// AttachSession lets a controller pick up a session that another controller started, and tells it what the
+// session is running. The session is then kept until the attached controller has closed it too.
+func (s *Server) AttachSession(req stubs.SessionRequest, res *stubs.StatusResponse) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+
+	s.accessSessions.Lock()
+	s.controllers[req.Session]++
+	s.accessSessions.Unlock()
+	*res = sim.Status()
+	return
+}
+
+// DetachSession lets a controller leave the session running, for a controller to attach to later.
+func (s *Server) DetachSession(req stubs.SessionRequest, res *stubs.Empty) (err error) {
+	if _, err = s.getSession(req.Session); err != nil {
+		return
+	}
+
+	s.accessSessions.Lock()
+	if s.controllers[req.Session] > 0 {
+		s.controllers[req.Session]--
+	}
+	s.accessSessions.Unlock()
+	fmt.Printf("Controller detached from session %d\n", req.Session)
+	return
+}
+
+// AwaitCalculation blocks until the session's calculation finishes. It is used by a controller that
+// attaches to a calculation in place of the CalculateForTurns call made by the controller that started it.
+func (s *Server) AwaitCalculation(req stubs.SessionRequest, res *stubs.TurnResponse) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+
+	res.CompletedTurns = sim.Await()
+	return
+}
+
+// CloseSession is called by a controller that has finished with the session. Once every controller using it
+// has closed it, or detached, the session's calculation is stopped and it is forgotten.
+func (s *Server) CloseSession(req stubs.SessionRequest, res *stubs.Empty) (err error) {
+	sim, err := s.getSession(req.Session)
+	if err != nil {
+		return
+	}
+
+	s.accessSessions.Lock()
+	s.controllers[req.Session]--
+	last := s.controllers[req.Session] <= 0
+	if last {
+		delete(s.sessions, req.Session)
+		delete(s.controllers, req.Session)
+	}
+	s.accessSessions.Unlock()
+	if last {
+		sim.Close()
+		fmt.Printf("Closed session %d\n", req.Session)
+	}
+	return
+}
+
+// Shutdown stops the caller's session, if it still has one. The server is only shut down if none of the
+// other sessions are running, or waiting to be run, as they belong to other controllers. Otherwise it
+// returns Busy. Once every calculation has stopped it calls the server's shutdown function.
+func (s *Server) Shutdown(req stubs.SessionRequest, res *stubs.Empty) (err error) {
+	var sims []*Simulation
+	s.accessSessions.Lock()
+	for session, sim := range s.sessions {
+		if session != req.Session && !sim.Finished() {
+			s.accessSessions.Unlock()
+			fmt.Println("Not shutting down, other sessions are running")
+			return stubs.Busy
+		}
+		sims = append(sims, sim)
+	}
+	s.accessSessions.Unlock()
+
+	fmt.Println("Shutting down!")
+	for _, sim := range sims {
+		sim.Stop()
+	}
+	s.shutdownOnce.Do(func() {
+		go func() {
+			for _, sim := range sims {
+				sim.Await()
+			}
+			s.shutdown()
+		}()
+	})
+	return
+}
+
+// ReceiveWorldData starts a new session with the world, and returns the session's ID.
+func (s *Server) ReceiveWorldData(req stubs.WorldRequest, res *stubs.SessionResponse) (err error) {
+	fmt.Println("Received world data!")
+
+	world, err := req.Unpack()
+	if err != nil {
+		return
+	}
+	sim := NewSimulation(s.newBackend)
+	if err = sim.Load(req.Params, world, req.Origin, req.Turn); err != nil {
+		return
+	}
+
+	s.accessSessions.Lock()
+	s.nextSession++
+	res.Session = s.nextSession
+	s.sessions[res.Session] = sim
+	s.controllers[res.Session] = 1
+	s.accessSessions.Unlock()
+	fmt.Printf("Started session %d\n", res.Session)
+	return
+}
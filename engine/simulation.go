@@ -0,0 +1,337 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// Simulation runs a calculation, stepping a Backend. It is in-process with LocalBackend, and on a broker
+// with backends that farm the turns out to its workers.
+type Simulation struct {
+	// Mutexes and semaphores, which are only read or changed with accessData held
+	isCalculating      bool
+	stopCalculating    bool
+	pauseCalculatingSP bool
+	accessData         sync.Mutex
+
+	// Critical data
+	params      golUtils.Params
+	newBackend  NewBackend
+	backend     Backend
+	currentTurn int
+	// The turn the backend's World is at, which lags behind while nobody is watching
+	viewTurn int
+	// How many watchers are waiting for a turn, which makes every step bring the world up to date
+	viewers int
+
+	// Closed when the running calculation finishes, for controllers that attach to it
+	calculationDone chan struct{}
+	// Set once a calculation has run and finished, so there is nothing more to watch
+	finished bool
+
+	// Closed and replaced whenever the turn, or what the watcher has seen, changes
+	changed  chan struct{}
+	watch    Watch
+	lockstep bool
+}
+
+// NewSimulation makes a simulation that has no world until it is loaded, and then runs it with newBackend.
+func NewSimulation(newBackend NewBackend) *Simulation {
+	return &Simulation{changed: make(chan struct{}), newBackend: newBackend}
+}
+
+// Lockstep makes Run wait for the watcher to be sent each turn before calculating the next,
+// so a watcher in the same process sees every turn. There must be a watcher calling Flips.
+func (sim *Simulation) Lockstep() {
+	sim.lockstep = true
+}
+
+// notify wakes everything waiting for the simulation to change. accessData must be held.
+func (sim *Simulation) notify() {
+	close(sim.changed)
+	sim.changed = make(chan struct{})
+}
+
+// waitUntil blocks until done returns true, checking it whenever the simulation changes,
+// or until the timeout if it isn't nil. It returns with accessData held.
+func (sim *Simulation) waitUntil(done func() bool, timeout <-chan time.Time) {
+	sim.accessData.Lock()
+	for !done() {
+		changed := sim.changed
+		sim.accessData.Unlock()
+		select {
+		case <-changed:
+		case <-timeout:
+			sim.accessData.Lock()
+			return
+		}
+		sim.accessData.Lock()
+	}
+}
+
+// loaded makes sure there is a world to use.
+func (sim *Simulation) loaded() error {
+	sim.accessData.Lock()
+	defer sim.accessData.Unlock()
+	if sim.backend == nil {
+		return stubs.NoWorld
+	}
+	return nil
+}
+
+// running checks whether the calculation can step, rather than being paused, stopped or finished.
+// accessData must be held.
+func (sim *Simulation) running() bool {
+	return sim.isCalculating && !sim.pauseCalculatingSP && !sim.stopCalculating
+}
+
+// sync brings the backend's world up to the current turn. accessData must be held, so it is between steps.
+func (sim *Simulation) sync() error {
+	if sim.viewTurn == sim.currentTurn {
+		return nil
+	}
+	if err := sim.backend.Sync(); err != nil {
+		return err
+	}
+	sim.viewTurn = sim.currentTurn
+	return nil
+}
+
+// Load replaces the world, returning BadRequest if the engine in p can't run it, or the
+// error from the backend if it is one of the stubs' codes.
+func (sim *Simulation) Load(p golUtils.Params, w golUtils.World, origin golUtils.CoOrds, turn int) error {
+	backend, err := sim.newBackend(p, w, origin)
+	if code, ok := err.(stubs.ErrorCode); ok {
+		return code
+	} else if err != nil {
+		return stubs.BadRequest
+	}
+
+	sim.accessData.Lock()
+	defer sim.accessData.Unlock()
+	if sim.isCalculating {
+		return stubs.Busy
+	}
+	sim.params = p
+	sim.backend = backend
+	sim.currentTurn = turn
+	sim.viewTurn = turn
+	sim.finished = false
+	// what watchers were sent is of a different world
+	sim.watch = Watch{}
+	sim.notify()
+	return nil
+}
+
+func (sim *Simulation) Run(turns int) (turn int, err error) {
+	if err = sim.loaded(); err != nil {
+		return
+	}
+	sim.accessData.Lock()
+	// Check calculations haven't already started
+	if sim.isCalculating {
+		sim.accessData.Unlock()
+		err = stubs.Busy
+		return
+	}
+	sim.isCalculating = true
+	sim.calculationDone = make(chan struct{})
+	sim.finished = false
+	turn = sim.currentTurn
+	sim.accessData.Unlock()
+
+	for turn < turns {
+		// wait until it isn't paused, and in lockstep until the watcher has been sent the last turn. The backend
+		// is stepped under the same lock, so the state is never read part way through a turn and no more turns
+		// are completed once it has been paused. It can advance several turns at once, but never past the last one
+		sim.waitUntil(func() bool {
+			return sim.stopCalculating || (!sim.pauseCalculatingSP && (!sim.lockstep || sim.watch.Seen(turn)))
+		}, nil)
+		if sim.stopCalculating {
+			sim.accessData.Unlock()
+			break
+		}
+		view := sim.lockstep || sim.viewers > 0
+		advanced, stepErr := sim.backend.Step(turns-turn, view)
+		turn += advanced
+		sim.currentTurn = turn
+		if stepErr != nil {
+			sim.accessData.Unlock()
+			err = stepErr
+			break
+		}
+		if view {
+			sim.viewTurn = turn
+		}
+		sim.notify()
+		sim.accessData.Unlock()
+	}
+
+	// reset stuff, bringing the world up to date before the backend lets go of it. If that fails,
+	// the calculation goes back to the last turn that was seen
+	sim.accessData.Lock()
+	if syncErr := sim.sync(); syncErr != nil {
+		sim.currentTurn = sim.viewTurn
+		if err == nil {
+			err = syncErr
+		}
+	}
+	turn = sim.currentTurn
+	sim.backend.Release()
+	close(sim.calculationDone)
+	sim.finished = true
+	sim.isCalculating = false
+	sim.stopCalculating = false
+	sim.notify()
+	sim.accessData.Unlock()
+	return
+}
+
+// Snapshot returns the current state. Backends never change a world they have returned, so it can be shared.
+func (sim *Simulation) Snapshot() (world golUtils.World, origin golUtils.CoOrds, turn int, err error) {
+	if err = sim.loaded(); err != nil {
+		return
+	}
+
+	sim.accessData.Lock()
+	defer sim.accessData.Unlock()
+	if err = sim.sync(); err != nil {
+		return
+	}
+	turn = sim.currentTurn
+	world, origin = sim.backend.World()
+	return
+}
+
+func (sim *Simulation) AliveCells() (turn int, alive int, err error) {
+	if err = sim.loaded(); err != nil {
+		return
+	}
+
+	sim.accessData.Lock()
+	turn = sim.currentTurn
+	alive = sim.backend.AliveCells()
+	sim.accessData.Unlock()
+	return
+}
+
+// Turn returns the number of completed turns.
+func (sim *Simulation) Turn() int {
+	sim.accessData.Lock()
+	defer sim.accessData.Unlock()
+	return sim.currentTurn
+}
+
+// setPaused changes the pause semaphore, waking Run up, and returns what it was before.
+// Run checks it under accessData before each step, so once it is set no more turns are completed until it is unset.
+func (sim *Simulation) setPaused(paused bool) (was bool) {
+	sim.accessData.Lock()
+	defer sim.accessData.Unlock()
+	was = sim.pauseCalculatingSP
+	sim.pauseCalculatingSP = paused
+	sim.notify()
+	return
+}
+
+func (sim *Simulation) Pause() (err error) {
+	if err = sim.loaded(); err != nil {
+		return
+	}
+
+	// set pause semaphore
+	if sim.setPaused(true) {
+		err = stubs.AlreadyPaused
+	}
+	return
+}
+
+func (sim *Simulation) Resume() (err error) {
+	if err = sim.loaded(); err != nil {
+		return
+	}
+
+	//unset pause semaphore and wake up the calculation
+	if !sim.setPaused(false) {
+		err = stubs.NotPaused
+	}
+	return
+}
+
+// Stop ends the calculation, waking it up first if it is paused or waiting for the watcher.
+func (sim *Simulation) Stop() error {
+	sim.accessData.Lock()
+	defer sim.accessData.Unlock()
+	sim.stopCalculating = true
+	sim.pauseCalculatingSP = false
+	sim.notify()
+	return nil
+}
+
+// Flips waits for a turn after since to be completed or the calculation to be paused or resumed,
+// for at most FlipsWait, and then returns the cells of the image that have changed since the watcher was last sent them.
+func (sim *Simulation) Flips(since int, paused bool) (res stubs.FlipsResponse, err error) {
+	if err = sim.loaded(); err != nil {
+		return
+	}
+
+	// while a watcher is waiting every step brings the world up to date, so it waits for the turn
+	// the world is at to move on, and never holds up the calculation to fetch it
+	req := stubs.FlipsRequest{Since: since, Paused: paused}
+	sim.accessData.Lock()
+	sim.viewers++
+	sim.accessData.Unlock()
+	sim.waitUntil(func() bool {
+		return !sim.watch.Waiting(req, sim.viewTurn, sim.pauseCalculatingSP) || sim.finished
+	}, time.After(FlipsWait))
+	sim.viewers--
+	defer sim.accessData.Unlock()
+	// once it isn't stepping, the world can be fetched without holding anything up
+	if !sim.running() {
+		if err = sim.sync(); err != nil {
+			return
+		}
+	}
+	world, origin := sim.backend.World()
+	view := golUtils.View(world, origin, sim.params.ImageWidth, sim.params.ImageHeight)
+	res = sim.watch.Flips(req, view, sim.viewTurn, sim.pauseCalculatingSP)
+	res.Finished = sim.finished
+	sim.notify()
+	return
+}
+
+// Close only stops the calculation, as Run releases the backend once it has stopped.
+func (sim *Simulation) Close() error {
+	return sim.Stop()
+}
+
+// Status reports what the simulation is running, for controllers that attach to it.
+func (sim *Simulation) Status() (status stubs.StatusResponse) {
+	sim.accessData.Lock()
+	status.Params = sim.params
+	status.CompletedTurns = sim.currentTurn
+	status.Paused = sim.pauseCalculatingSP
+	status.Calculating = sim.isCalculating
+	sim.accessData.Unlock()
+	return
+}
+
+// Finished checks whether the simulation has run and finished, rather than running or waiting to be run.
+func (sim *Simulation) Finished() bool {
+	sim.accessData.Lock()
+	defer sim.accessData.Unlock()
+	return sim.finished
+}
+
+// Await blocks until the running calculation, if there is one, finishes, and returns the number of completed turns.
+func (sim *Simulation) Await() int {
+	sim.accessData.Lock()
+	done := sim.calculationDone
+	sim.accessData.Unlock()
+	if done != nil {
+		<-done
+	}
+	return sim.Turn()
+}
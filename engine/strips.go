@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"fmt"
+	"net/rpc"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// stripOwner is a worker that owns a strip of the world in halo exchange mode.
+type stripOwner struct {
+	worker *poolWorker
+	startY int
+	endY   int
+}
+
+// haloBackend gives each worker in the pool ownership of a strip of the world, and the workers swap
+// their edge rows with each other directly. The broker keeps a copy of the world, which is only brought
+// up to date with the cells that have changed, and only when it is viewed.
+type haloBackend struct {
+	pool   *WorkerPool
+	params golUtils.Params
+	// stripKey identifies the strips on the workers
+	stripKey int
+	owners   []stripOwner
+	// turn counts the steps, which the workers check they agree on, and worldTurn is the step world is at.
+	// The strips are handed out at worldTurn, so they can be handed out again if a worker fails.
+	turn       int
+	worldTurn  int
+	world      golUtils.World
+	aliveCells int
+}
+
+// isConnectionError tells apart errors from the connection to a worker and errors returned by the worker itself.
+func isConnectionError(err error) bool {
+	switch err.(type) {
+	case nil, rpc.ServerError, stubs.ErrorCode:
+		return false
+	default:
+		return true
+	}
+}
+
+// distribute gives each worker in the pool ownership of a strip of the world as it was last synced, and
+// tells it who its neighbours are. Failed is a worker that couldn't be reached, if any.
+func (b *haloBackend) distribute() (failed *poolWorker, err error) {
+	workers := b.pool.snapshot()
+	if len(workers) == 0 {
+		return nil, stubs.NoWorkers
+	}
+
+	bounds := stripBounds(workers, b.params.ImageHeight)
+	var owners []stripOwner
+	for i, worker := range workers {
+		if bounds[i+1] > bounds[i] {
+			owners = append(owners, stripOwner{worker: worker, startY: bounds[i], endY: bounds[i+1]})
+		}
+	}
+
+	calls := make([]*rpc.Call, len(owners))
+	for i, owner := range owners {
+		request := stubs.StripRequest{
+			Session: b.stripKey,
+			Params:  b.params,
+			Strip:   golUtils.PackWorld(b.world[owner.startY:owner.endY]),
+			Above:   owners[(i-1+len(owners))%len(owners)].worker.address,
+			Below:   owners[(i+1)%len(owners)].worker.address,
+			Turn:    b.worldTurn,
+			First:   i == 0,
+			Last:    i == len(owners)-1,
+		}
+		calls[i] = owner.worker.client.Go(string(stubs.LoadStrip), request, new(stubs.Empty), nil)
+	}
+	for i, call := range calls {
+		<-call.Done
+		if isConnectionError(call.Error) && failed == nil {
+			failed = owners[i].worker
+		}
+		if call.Error != nil && err == nil {
+			err = call.Error
+		}
+	}
+	b.owners = owners
+	b.turn = b.worldTurn
+	if err != nil {
+		b.release()
+		b.owners = nil
+	}
+	return
+}
+
+// update brings the world up to date with what has changed in each strip. Only the rows that change are
+// copied, as the old world may still be watched.
+func (b *haloBackend) update(changes []stubs.StripFlips) error {
+	world := make(golUtils.World, len(b.world))
+	copy(world, b.world)
+	copied := make([]bool, len(world))
+	for i, owner := range b.owners {
+		if changes[i].Reset {
+			for y := owner.startY; y < owner.endY; y++ {
+				world[y] = make([]byte, b.params.ImageWidth)
+				copied[y] = true
+			}
+		}
+		for _, flip := range changes[i].Flips {
+			x, y := flip.Cell.X, owner.startY+flip.Cell.Y
+			if x < 0 || x >= b.params.ImageWidth || y < owner.startY || y >= owner.endY {
+				return stubs.BadRequest
+			}
+			if !copied[y] {
+				row := make([]byte, len(world[y]))
+				copy(row, world[y])
+				world[y] = row
+				copied[y] = true
+			}
+			world[y][x] = flip.State
+		}
+	}
+	b.world = world
+	b.worldTurn = b.turn
+	return nil
+}
+
+// Step advances every strip by one turn, handing the strips out first if the workers don't have them.
+// When it is viewed, what has changed comes back with the step, so it costs no more calls. If a worker
+// fails it is dropped from the pool, and the strips are handed out again from the world as it was last
+// synced, so the turns since are stepped again.
+func (b *haloBackend) Step(turns int, view bool) (int, error) {
+	target := b.turn + 1
+	for b.turn < target {
+		var failed *poolWorker
+		var err error
+		if b.owners == nil {
+			failed, err = b.distribute()
+		} else {
+			failed, err = b.step(view && b.turn+1 == target)
+		}
+		if failed != nil {
+			fmt.Printf("Worker %s failed, dropping it from the pool\n", failed.address)
+			b.pool.remove(failed.address)
+			b.owners = nil
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 1, nil
+}
+
+// step advances every strip by one turn. Once a step fails the strips are released, as the other workers
+// may be waiting for halos that won't come. Failed is a worker that couldn't be reached, if any.
+func (b *haloBackend) step(view bool) (failed *poolWorker, err error) {
+	done := make(chan *rpc.Call, len(b.owners))
+	owners := make(map[*rpc.Call]*poolWorker, len(b.owners))
+	responses := make([]*stubs.StepResponse, len(b.owners))
+	for i, owner := range b.owners {
+		responses[i] = new(stubs.StepResponse)
+		request := stubs.StepRequest{Session: b.stripKey, Turn: b.turn, View: view, Since: b.worldTurn}
+		owners[owner.worker.client.Go(string(stubs.StepStrip), request, responses[i], done)] = owner.worker
+	}
+
+	var released chan struct{}
+	for range b.owners {
+		call := <-done
+		if isConnectionError(call.Error) && failed == nil {
+			failed = owners[call]
+		}
+		if call.Error != nil && err == nil {
+			err = call.Error
+			released = make(chan struct{})
+			go func() {
+				b.release()
+				close(released)
+			}()
+		}
+	}
+	if err != nil {
+		<-released
+		b.owners = nil
+		return
+	}
+
+	b.turn++
+	b.aliveCells = 0
+	for _, response := range responses {
+		b.aliveCells += response.AliveCells
+	}
+	if view {
+		changes := make([]stubs.StripFlips, len(b.owners))
+		for i, response := range responses {
+			changes[i] = response.Changes
+		}
+		err = b.update(changes)
+	}
+	return
+}
+
+// Sync fetches what has changed in every strip since the world was last brought up to date.
+func (b *haloBackend) Sync() error {
+	if b.worldTurn == b.turn {
+		return nil
+	}
+	if b.owners == nil {
+		return stubs.NoWorld
+	}
+
+	calls := make([]*rpc.Call, len(b.owners))
+	responses := make([]*stubs.StripFlipsResponse, len(b.owners))
+	for i, owner := range b.owners {
+		responses[i] = new(stubs.StripFlipsResponse)
+		request := stubs.StripFlipsRequest{Session: b.stripKey, Since: b.worldTurn}
+		calls[i] = owner.worker.client.Go(string(stubs.SendStrip), request, responses[i], nil)
+	}
+
+	changes := make([]stubs.StripFlips, len(b.owners))
+	var err error
+	for i, call := range calls {
+		<-call.Done
+		if call.Error != nil && err == nil {
+			err = call.Error
+		}
+		// a strip that missed a step can't be stitched to the others
+		if call.Error == nil && responses[i].CompletedTurns != b.turn && err == nil {
+			err = stubs.BadRequest
+		}
+		changes[i] = responses[i].Changes
+	}
+	if err != nil {
+		return err
+	}
+	return b.update(changes)
+}
+
+func (b *haloBackend) World() (golUtils.World, golUtils.CoOrds) {
+	return b.world, golUtils.CoOrds{}
+}
+
+func (b *haloBackend) AliveCells() int {
+	return b.aliveCells
+}
+
+// release lets the workers free their strips. Workers that can't be reached are ignored, as they no
+// longer hold the strip anyway.
+func (b *haloBackend) release() {
+	calls := make([]*rpc.Call, len(b.owners))
+	for i, owner := range b.owners {
+		calls[i] = owner.worker.client.Go(string(stubs.ReleaseStrip), stubs.SessionRequest{Session: b.stripKey}, new(stubs.Empty), nil)
+	}
+	for _, call := range calls {
+		<-call.Done
+	}
+}
+
+// Release frees the strips on the workers. Steps that weren't synced are lost, so the world goes back to
+// the last turn it was synced at, as the Simulation does.
+func (b *haloBackend) Release() {
+	b.release()
+	b.owners = nil
+	if b.worldTurn != b.turn {
+		b.aliveCells = golUtils.CountCells(b.world)
+	}
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// FlipsWait is the longest a request for flips waits for a new turn, so a controller can stop watching.
+const FlipsWait = time.Second
+
+// watchHistory is how many of the images sent to watchers are kept, so that several controllers
+// watching the same calculation at different rates can each be sent only what has changed.
+const watchHistory = 4
+
+// Watch remembers the images that controllers watching a calculation were last sent, by turn,
+// so that they only have to be sent the cells that have changed since.
+type Watch struct {
+	sent  map[int]golUtils.World
+	turns []int
+}
+
+// Seen checks whether a watcher has been sent the given turn.
+func (w *Watch) Seen(turn int) bool {
+	return len(w.turns) > 0 && w.turns[len(w.turns)-1] >= turn
+}
+
+// Waiting checks whether there is nothing new to send a watcher that was last sent turn req.Since, and told
+// whether the calculation was paused, until the calculation moves on from turn or is paused or resumed.
+func (w *Watch) Waiting(req stubs.FlipsRequest, turn int, paused bool) bool {
+	return req.Since >= 0 && w.sent[req.Since] != nil && turn <= req.Since && paused == req.Paused
+}
+
+// Flips compares the image against what the watcher was sent at turn req.Since. If that is no longer
+// kept, e.g. because it has only just started watching, it is sent the whole image.
+// Engines never change a world they have returned, so the image is kept without copying it.
+func (w *Watch) Flips(req stubs.FlipsRequest, view golUtils.World, turn int, paused bool) (res stubs.FlipsResponse) {
+	var old golUtils.World
+	if req.Since >= 0 {
+		old = w.sent[req.Since]
+	}
+	if old == nil {
+		res.Reset = true
+	}
+	res.Flips = golUtils.Diff(old, view)
+	res.CompletedTurns = turn
+	res.Paused = paused
+
+	if w.sent == nil {
+		w.sent = make(map[int]golUtils.World)
+	}
+	if w.sent[turn] == nil {
+		w.turns = append(w.turns, turn)
+	}
+	w.sent[turn] = view
+	if len(w.turns) > watchHistory {
+		delete(w.sent, w.turns[0])
+		w.turns = w.turns[1:]
+	}
+	return
+}
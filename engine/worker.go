@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// GOLWorker answers the calls for whole world calculations through the embedded Server,
+// and the calls from a broker for strips of a world. It is registered under its own name.
+type GOLWorker struct {
+	*Server
+
+	// Strips owned in halo exchange mode, by the session the broker gave them
+	accessStrips sync.Mutex
+	strips       map[int]*stripState
+}
+
+// NewGOLWorker makes a worker that runs whole worlds in-process. Shutdown is called once the
+// calculations have stopped and the strips have been released.
+func NewGOLWorker(shutdown func()) *GOLWorker {
+	g := &GOLWorker{strips: make(map[int]*stripState)}
+	g.Server = NewServer(LocalBackend, func() {
+		g.releaseStrips()
+		shutdown()
+	})
+	return g
+}
+
+// CalculateSection is used by the broker. It receives a strip of the world with one halo row
+// above and below it, and returns the next state of the strip without the halo rows.
+func (g *GOLWorker) CalculateSection(req stubs.SectionRequest, res *stubs.SectionResponse) (err error) {
+	section, err := req.Section.Unpack()
+	if err != nil || req.Section.Height < 3 {
+		err = stubs.BadRequest
+		return
+	}
+	params := req.Params
+	params.ImageHeight = req.Section.Height
+	params.ImageWidth = req.Section.Width
+
+	// the halo rows are only read, so the wrap around at the edges of the section never affects the result
+	newSection := golUtils.CalculateNextState(params, section, golUtils.CoOrds{X: 0, Y: 1}, golUtils.CoOrds{X: params.ImageWidth, Y: params.ImageHeight - 1})
+	res.Section = golUtils.PackWorld(newSection)
+	return
+}
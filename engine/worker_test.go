@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestWorkerBadWorlds checks that a worker refuses worlds that are empty or don't fit their parameters
+// as BadRequest, rather than starting a session that would crash the worker once it was run.
+func TestWorkerBadWorlds(t *testing.T) {
+	world := golUtils.PackWorld(golUtils.MakeWorld(16, 16))
+	params := golUtils.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1}
+	infinite := params
+	infinite.Boundary = golUtils.Infinite
+	empty := golUtils.Params{Turns: 1}
+
+	tests := []struct {
+		name string
+		req  stubs.WorldRequest
+	}{
+		{"empty world", stubs.WorldRequest{Params: empty, World: golUtils.PackWorld(golUtils.World{})}},
+		{"empty world for a 16x16 image", stubs.WorldRequest{Params: params, World: golUtils.PackWorld(golUtils.World{})}},
+		{"empty image", stubs.WorldRequest{Params: empty, World: world}},
+		{"empty image on the infinite plane", stubs.WorldRequest{Params: golUtils.Params{Boundary: golUtils.Infinite}, World: world}},
+		{"smaller world", stubs.WorldRequest{Params: params, World: golUtils.PackWorld(golUtils.MakeWorld(8, 8))}},
+		{"bigger world", stubs.WorldRequest{Params: params, World: golUtils.PackWorld(golUtils.MakeWorld(32, 32))}},
+		{"image past the world", stubs.WorldRequest{Params: infinite, World: world, Origin: golUtils.CoOrds{X: 1}}},
+		{"negative origin", stubs.WorldRequest{Params: infinite, World: world, Origin: golUtils.CoOrds{X: -1}}},
+		{"negative turn", stubs.WorldRequest{Params: params, World: world, Turn: -1}},
+		{"negative size", stubs.WorldRequest{Params: params, World: golUtils.PackedWorld{Width: -16, Height: 16, Bits: 1}}},
+	}
+
+	worker := NewGOLWorker(func() {})
+	for _, test := range tests {
+		if err := worker.ReceiveWorldData(test.req, new(stubs.SessionResponse)); err != stubs.BadRequest {
+			t.Errorf("%s gave %v, expected %v", test.name, err, stubs.BadRequest)
+		}
+	}
+
+	// the worker is still up and takes a good world
+	res := new(stubs.SessionResponse)
+	if err := worker.ReceiveWorldData(stubs.WorldRequest{Params: params, World: world}, res); err != nil {
+		t.Fatal(err)
+	}
+	if err := worker.CalculateForTurns(stubs.TurnsRequest{Session: res.Session, Turns: 1}, new(stubs.TurnResponse)); err != nil {
+		t.Error(err)
+	}
+}
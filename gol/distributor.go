@@ -3,9 +3,9 @@ package gol
 import (
 	"fmt"
 	"net/rpc"
-	"strings"
 	"time"
 
+	"uk.ac.bris.cs/gameoflife/engine"
 	"uk.ac.bris.cs/gameoflife/golUtils"
 	"uk.ac.bris.cs/gameoflife/stubs"
 	"uk.ac.bris.cs/gameoflife/util"
@@ -16,92 +16,100 @@ type distributorChannels struct {
 	keyPresses <-chan rune
 	ioCommand  chan<- ioCommand
 	ioIdle     <-chan bool
+	ioError    <-chan error
 	ioFilename chan<- string
+	ioTurn     chan<- int
 	ioOutput   chan<- uint8
 	ioInput    <-chan uint8
+	ioWritten  <-chan ImageOutputComplete
 }
 
-const serverIP string = "44.203.176.152"
-const serverPort string = "8030"
-
-func makeCall(client *rpc.Client, message string, callType stubs.Stub) string {
-	request := stubs.Request{Message: message}
-	response := new(stubs.Response)
-	calltype := string(callType)
-	client.Call(calltype, request, response)
-	fmt.Println("Response from call " + callType)
-	return response.Message
-}
-
-func makeAsyncCall(client *rpc.Client, message string, callType stubs.Stub) (done *rpc.Call, response *stubs.Response) {
-	request := stubs.Request{Message: message}
-	response = new(stubs.Response)
-	calltype := string(callType)
-	done = client.Go(calltype, request, response, nil)
-	fmt.Println("Response from call " + callType)
-
-	return
+// makeCall gives up on the server after engine.CallTimeout, as the engine's client does.
+func makeCall(client *rpc.Client, callType stubs.Stub, request interface{}, response interface{}) error {
+	return engine.Call(client, callType, request, response)
 }
 
 func (c *distributorChannels) generatePGMFile(w golUtils.World, p Params, t int) {
 	// Tell IO channel to output
 	c.ioCommand <- ioOutput
 
-	// Generate file name
-	c.ioFilename <- fmt.Sprintf("%dx%dx%d",
-		p.ImageWidth,
-		p.ImageHeight,
-		t)
+	// Tell IO which turn it is, which it names the file after
+	c.ioTurn <- t
 
-	for x := 0; x < p.ImageWidth; x++ {
-		for y := 0; y < p.ImageHeight; y++ {
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
 			c.ioOutput <- w[y][x]
 		}
 	}
 
+	c.reportWritten()
 }
 
-func worldToString(p Params, w golUtils.World) string {
-	param := fmt.Sprintf("%d,%d,%d,%d", p.ImageHeight, p.ImageWidth, p.Threads, p.Turns)
-	fmt.Println("sending params:" + param)
-	var world string
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			world = world + fmt.Sprintf("%d,", w[x][y])
+// recordFrame sends the world to IO as the next frame of the animated GIF being recorded.
+func (c *distributorChannels) recordFrame(w golUtils.World) {
+	c.ioCommand <- ioFrame
+	for _, row := range w {
+		for _, cell := range row {
+			c.ioOutput <- cell
 		}
 	}
-	out := param + ";" + world
-	return out
 }
 
-// Height,Length;cell0,cell1,...
-
-func parseOutput(p Params, s string) (w golUtils.World, t int, err error) {
-	err = nil
-	sSplit := strings.Split(s, ";")
+// generateGIFFile saves the frames recorded so far as an animated GIF, named after the turn it ends on.
+func (c *distributorChannels) generateGIFFile(t int) {
+	c.ioCommand <- ioAnimation
+	c.ioTurn <- t
+	c.reportWritten()
+}
 
-	if _, err := fmt.Sscan(sSplit[0], &t); err != nil {
-		return nil, 0, err
+// reportWritten waits for IO to say where it has written a file, and passes that on.
+func (c *distributorChannels) reportWritten() {
+	if err := <-c.ioError; err != nil {
+		fmt.Println("Couldn't save image:", err)
+		return
 	}
+	written := <-c.ioWritten
+	c.events <- written
+}
 
-	w = golUtils.MakeWorld(p.ImageHeight, p.ImageWidth)
-	wSplit := strings.Split(sSplit[1], ",")
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			fmt.Sscan(wSplit[x+y*p.ImageHeight], &w[x][y])
-		}
+func workerParams(p Params) (golUtils.Params, error) {
+	rule, err := golUtils.ParseRule(p.Rule)
+	if err != nil {
+		return golUtils.Params{}, err
 	}
-	return
+	boundary, err := golUtils.ParseBoundary(p.Boundary)
+	if err != nil {
+		return golUtils.Params{}, err
+	}
+	params := golUtils.Params{
+		Turns:       p.Turns,
+		Threads:     p.Threads,
+		ImageWidth:  p.ImageWidth,
+		ImageHeight: p.ImageHeight,
+		Rule:        rule,
+		Boundary:    boundary,
+		Engine:      p.Engine,
+	}
+	// the server can only say the request was bad, so the reason is found out here
+	return params, golUtils.CheckEngine(params)
 }
 
+// checkpointTicks is how many ticks go between fetching the whole world from the server on the infinite plane.
+const checkpointTicks = 15
+
 func tick(finish chan bool, tick chan bool) {
 	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-finish:
 			return
 		case <-ticker.C:
-			tick <- true
+			select {
+			case tick <- true:
+			case <-finish:
+				return
+			}
 		}
 	}
 }
@@ -115,96 +123,196 @@ func distributor(p Params, c distributorChannels) {
 	c.ioCommand <- ioCheckIdle
 	<-c.ioIdle
 
-	// Tell IO to read file then put that read into the slice
-	c.ioCommand <- ioInput
-	c.ioFilename <- fmt.Sprintf("%dx%d", p.ImageWidth, p.ImageHeight)
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			worldSlice[x][y] = <-c.ioInput
+	// Tell IO to read file then put that read into the slice.
+	// When attaching, the world comes from the server instead.
+	if !p.Attach {
+		input := p.Input
+		if input == "" {
+			input = fmt.Sprintf("images/%dx%d.pgm", p.ImageWidth, p.ImageHeight)
+		}
+		c.ioCommand <- ioInput
+		c.ioFilename <- input
+		if err := <-c.ioError; err != nil {
+			fmt.Println("Couldn't read input image:", err)
+			c.events <- StateChange{0, Quitting}
+			close(c.events)
+			return
+		}
+		for y := 0; y < p.ImageHeight; y++ {
+			for x := 0; x < p.ImageWidth; x++ {
+				worldSlice[y][x] = <-c.ioInput
+			}
 		}
 	}
 
-	// Connect to server
-	server := fmt.Sprintf("%s:%s", serverIP, serverPort)
-	client, _ := rpc.Dial("tcp", server)
-
-	worldString := worldToString(p, worldSlice)
+	// Connect to server and send it the world and parameters, or attach to what it is running
+	session := newSession(p, worldSlice)
+	var finished <-chan error
+	err := session.connect()
+	if err == nil {
+		session.printPool()
+		if p.Attach {
+			finished, err = session.attach()
+			p.Turns = session.params.Turns
+			p.Rule = session.params.Rule
+			p.Boundary = session.params.Boundary
+			p.Engine = session.params.Engine
+		} else {
+			finished, err = session.start()
+		}
+	}
+	if err != nil {
+		fmt.Println("Couldn't start calculation:", err)
+		c.events <- StateChange{0, Quitting}
+		close(c.events)
+		return
+	}
 
-	// Send world and parameters to server
-	makeCall(client, worldString, stubs.SendWorldData)
+	// Stream the cells that change to the GUI
+	watch := newWatcher(c.events, p.ImageWidth, p.ImageHeight)
+	if p.GifEvery > 0 {
+		// a remote calculation may be past its first turn by the time it is watched, so that is recorded here
+		recorded := -1
+		if !p.Attach {
+			c.recordFrame(worldSlice)
+			recorded = 0
+		}
+		// IO only takes a command once it has finished the last, so the watcher can send it frames itself
+		watch.recordEvery(p.GifEvery, c.recordFrame, recorded)
+	}
+	watch.start(session.engine, session.frameInterval())
 
 	tickerEnd := make(chan bool)
 	tickerNotify := make(chan bool)
 	go tick(tickerEnd, tickerNotify)
 
-	elapsedTurns := 0
-	aliveCells := 0
-	// Tell server to calculate
-	workerFin, _ := makeAsyncCall(client, fmt.Sprint(p.Turns), stubs.CalculateNTurns)
-
+	ticks := 0
 	golFinish := false
-	isPaused := false
 	output := false
+	shutdown := false
+	detached := false
 	for !golFinish {
+		var err error
 		select {
 		case <-tickerNotify:
-			receivedCellCount := makeCall(client, "", stubs.SendCellCount)
-			parseData := strings.Split(receivedCellCount, ",")
-			fmt.Sscan(parseData[0], &elapsedTurns)
-			fmt.Sscan(parseData[1], &aliveCells)
-			c.events <- AliveCellsCount{elapsedTurns, aliveCells}
+			var turn, alive int
+			if turn, alive, err = session.engine.AliveCells(); err == nil {
+				c.events <- AliveCellsCount{turn, alive}
+			}
+			// the watcher keeps a recent state to resume from if the server is lost, apart from on the infinite plane
+			if ticks++; err == nil && ticks%checkpointTicks == 0 && session.infinite() {
+				err = session.checkpoint()
+			}
 		case keyPress := <-c.keyPresses:
 			switch keyPress {
 			case 'p':
-
-				if isPaused {
-					makeCall(client, "", stubs.UnPauseCalculations)
-				} else {
-					makeCall(client, "", stubs.PauseCalculations)
+				// another controller may have paused or resumed the calculation, so the server says which to do.
+				// The watcher sends the StateChange once the server has done it
+				if err = session.engine.Pause(); stubs.CodeOf(err) == stubs.AlreadyPaused {
+					err = session.engine.Resume()
 				}
-				isPaused = !isPaused
-				continue
 			case 's':
-				currentState := makeCall(client, "", stubs.SendCurrentState)
-				currentWorld, turn, _ := parseOutput(p, currentState)
-				c.generatePGMFile(currentWorld, p, turn)
-				continue
+				if err = session.checkpoint(); err == nil {
+					c.generatePGMFile(session.view(), p, session.turn)
+				}
 			case 'q':
-				makeCall(client, "", stubs.StopCalculations)
+				if session.remote == nil {
+					// there is nothing to attach to later in-process, so the calculation is stopped
+					err = session.engine.Stop()
+					golFinish = true
+					output = true
+					break
+				}
+				// detach, leaving the server calculating so a controller can attach to it later
+				fmt.Printf("Detaching from server, use -attach -session %d to pick the calculation back up\n", session.id)
 				golFinish = true
+				detached = true
 			case 'k':
-				makeCall(client, "", stubs.StopCalculations)
+				err = session.engine.Stop()
 				golFinish = true
 				output = true
+				shutdown = true
+			}
+		case err = <-finished:
+			// a calculation that failed has no final state to report
+			if !isConnectionError(err) {
+				if err != nil {
+					fmt.Println("Calculation failed:", err)
+				}
+				golFinish = true
+				output = err == nil
 			}
-		case <-workerFin.Done:
-			golFinish = true
-			output = true
 		}
+
+		// Once we are finishing there is nothing left to resume, the last known state is used instead
+		if isConnectionError(err) && !golFinish {
+			watch.halt()
+			session.watched(watch.view())
+			finished, err = session.recover(c.events)
+			if err != nil {
+				fmt.Println("Couldn't resume calculation:", err)
+				golFinish = true
+				output = true
+			} else {
+				watch.start(session.engine, session.frameInterval())
+			}
+		}
+	}
+
+	close(tickerEnd)
+
+	// let the GUI catch up with the end of the calculation, unless we are leaving it running
+	if detached {
+		watch.halt()
+	} else {
+		watch.wait()
+	}
+	session.watched(watch.view())
+
+	// get the final calculated state, keeping the last known state if the server has gone
+	if err := session.checkpoint(); err != nil {
+		fmt.Println("Couldn't get final state:", err)
+	}
+	worldSlice = session.view()
+	turn := session.turn
+
+	// free the session on the server, unless another controller may attach to it later
+	if detached {
+		session.remote.Detach()
+	} else {
+		session.engine.Close()
 	}
 
-	finishedState := makeCall(client, "", stubs.SendCurrentState)
-	// parse the final calculated state\
-	worldSlice, turn, _ := parseOutput(p, finishedState)
+	// the connection can drop before the reply arrives, which is fine as the server is going away
+	if shutdown {
+		session.shutdown()
+	}
 
 	//close server connection
-	client.Close()
+	session.close()
+
+	// Save the recording of the run however it ended, before the window can close
+	if p.GifEvery > 0 {
+		c.generateGIFFile(turn)
+	}
 
 	// Report the final state using FinalTurnComplete event.
 	if output {
 		// Turn worldSlice into slice of util.cells
 		cellSlice := make([]util.Cell, 0)
-		for x := 0; x < p.ImageWidth; x++ {
-			for y := 0; y < p.ImageHeight; y++ {
-				if worldSlice[x][y] == golUtils.LiveCell {
+		for y := 0; y < p.ImageHeight; y++ {
+			for x := 0; x < p.ImageWidth; x++ {
+				if worldSlice[y][x] == golUtils.LiveCell {
 					cellSlice = append(cellSlice, util.Cell{X: x, Y: y})
 				}
 			}
 		}
 
+		// Save the final image first, so it has been written by the time the window closes
+		c.generatePGMFile(worldSlice, p, turn)
+
 		// Send FinalTurnComplete event to channel
 		c.events <- FinalTurnComplete{turn, cellSlice}
-		c.generatePGMFile(worldSlice, p, p.Turns)
 	}
 
 	// Make sure that the Io has finished any output before exiting.
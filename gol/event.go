@@ -36,6 +36,9 @@ const (
 	Paused State = iota
 	Executing
 	Quitting
+	// Reconnecting is sent when the connection to the server is lost. Executing follows once the
+	// calculation has been resumed, on the same server or another one.
+	Reconnecting
 )
 
 // StateChange is an Event notifying the user about the change of state of execution.
@@ -53,9 +56,18 @@ type CellFlipped struct { // implements Event
 	Cell           util.Cell
 }
 
+// CellShaded is an Event notifying the GUI that a cell has moved into or out of one of the dying states
+// of a Generations rule. Level is the cell's new grey level, which the GUI shows as it is.
+// When an alive cell starts dying, CellFlipped must be sent for it first and then CellShaded.
+type CellShaded struct { // implements Event
+	CompletedTurns int
+	Cell           util.Cell
+	Level          uint8
+}
+
 // TurnComplete is an Event notifying the GUI about turn completion.
 // SDL will render a frame when this event is sent.
-// All CellFlipped events must be sent *before* TurnComplete.
+// All CellFlipped and CellShaded events must be sent *before* TurnComplete.
 type TurnComplete struct { // implements Event
 	CompletedTurns int
 }
@@ -78,6 +90,8 @@ func (state State) String() string {
 		return "Executing"
 	case Quitting:
 		return "Quitting"
+	case Reconnecting:
+		return "Reconnecting"
 	default:
 		return "Incorrect State"
 	}
@@ -115,6 +129,14 @@ func (event CellFlipped) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event CellShaded) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event CellShaded) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event TurnComplete) String() string {
 	return fmt.Sprintf("")
 }
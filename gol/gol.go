@@ -6,6 +6,18 @@ type Params struct {
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+	Input       string
+	Offset      string
+	Rule        string
+	Boundary    string
+	Engine      string
+	OutDir      string
+	OutName     string
+	Format      string
+	GifEvery    int
+	Server      string
+	Attach      bool
+	Session     int
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
@@ -13,16 +25,22 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 
 	ioCommand := make(chan ioCommand)
 	ioIdle := make(chan bool)
+	ioError := make(chan error)
 	ioFilename := make(chan string)
+	ioTurn := make(chan int)
 	ioOutput := make(chan uint8)
 	ioInput := make(chan uint8)
+	ioWritten := make(chan ImageOutputComplete)
 
 	ioChannels := ioChannels{
 		command:  ioCommand,
 		idle:     ioIdle,
+		err:      ioError,
 		filename: ioFilename,
+		turn:     ioTurn,
 		output:   ioOutput,
 		input:    ioInput,
+		written:  ioWritten,
 	}
 	go startIo(p, ioChannels)
 
@@ -31,9 +49,12 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		keyPresses: keyPresses,
 		ioCommand:  ioCommand,
 		ioIdle:     ioIdle,
+		ioError:    ioError,
 		ioFilename: ioFilename,
+		ioTurn:     ioTurn,
 		ioOutput:   ioOutput,
 		ioInput:    ioInput,
+		ioWritten:  ioWritten,
 	}
 	distributor(p, distributorChannels)
 }
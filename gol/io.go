@@ -1,28 +1,40 @@
 package gol
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
-	"uk.ac.bris.cs/gameoflife/util"
+	"uk.ac.bris.cs/gameoflife/golUtils"
 )
 
 type ioChannels struct {
 	command <-chan ioCommand
 	idle    chan<- bool
+	err     chan<- error
 
 	filename <-chan string
+	turn     <-chan int
 	output   <-chan uint8
 	input    chan<- uint8
+	written  chan<- ImageOutputComplete
 }
 
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
 	params   Params
 	channels ioChannels
+
+	// The animated GIF being recorded goes to a temporary file until it is written, as it is named after
+	// the turn it ends on. Any error recording it is kept until then too.
+	animation    *golUtils.Animation
+	recording    *os.File
+	recordingErr error
 }
 
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
@@ -33,94 +45,334 @@ type ioCommand uint8
 //		ioOutput 	= 0
 //		ioInput 	= 1
 //		ioCheckIdle = 2
+//		ioFrame 	= 3
+//		ioAnimation = 4
 const (
 	ioOutput ioCommand = iota
 	ioInput
 	ioCheckIdle
+	ioFrame
+	ioAnimation
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
-func (io *ioState) writePgmImage() {
-	_ = os.Mkdir("out", os.ModePerm)
+// Used when Params.OutDir, Params.OutName and Params.Format are left empty, e.g. by the tests.
+const (
+	defaultOutDir  = "out"
+	defaultOutName = "{size}x{turn}"
+	defaultFormat  = "pgm"
+)
 
-	// Request a filename from the distributor.
-	filename := <-io.channels.filename
+// gifDelay is how long each frame of an animated GIF is shown for, in hundredths of a second.
+const gifDelay = 10
 
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	util.Check(ioError)
-	defer file.Close()
+// outputName fills in the filename template in Params.OutName for an image of the given turn.
+// {size} is the width and height, e.g. 512x512, {width}, {height} and {turn} are numbers,
+// {rule} is the rule in B/S notation and {timestamp} is the local time the image is saved at.
+func outputName(p Params, turn int) string {
+	template := p.OutName
+	if template == "" {
+		template = defaultOutName
+	}
+	rule := p.Rule
+	if parsed, err := golUtils.ParseRule(p.Rule); err == nil {
+		rule = parsed.String()
+	}
+
+	return strings.NewReplacer(
+		"{size}", fmt.Sprintf("%dx%d", p.ImageWidth, p.ImageHeight),
+		"{width}", strconv.Itoa(p.ImageWidth),
+		"{height}", strconv.Itoa(p.ImageHeight),
+		"{turn}", strconv.Itoa(turn),
+		// the slashes in B/S notation would otherwise be taken as directories
+		"{rule}", strings.Replace(rule, "/", "-", -1),
+		"{timestamp}", time.Now().Format("20060102-150405"),
+	).Replace(template)
+}
 
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
+// writePgmImage receives an array of bytes and writes it to a file in the output directory, as a pgm
+// image unless Params.Format asks for another format.
+// It reports whether that worked to the distributor, and if it did where the file is.
+func (io *ioState) writePgmImage() {
+	// Request the turn the image is of from the distributor, to name the file after.
+	turn := <-io.channels.turn
+	filename := outputName(io.params, turn)
+	world := io.receiveWorld()
 
-	world := make([][]byte, io.params.ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, io.params.ImageWidth)
+	format := io.params.Format
+	if format == "" {
+		format = defaultFormat
+	}
+	path := io.outputPath(filename + "." + format)
+	err := writeImage(path, world, format, io.params.Rule)
+	io.channels.err <- err
+	if err != nil {
+		return
 	}
 
+	fmt.Println("File", filename, "output done!")
+	io.channels.written <- ImageOutputComplete{turn, path}
+}
+
+// receiveWorld receives a world from the distributor as an array of bytes.
+func (io *ioState) receiveWorld() golUtils.World {
+	world := golUtils.MakeWorld(io.params.ImageHeight, io.params.ImageWidth)
 	for y := 0; y < io.params.ImageHeight; y++ {
 		for x := 0; x < io.params.ImageWidth; x++ {
-			val := <-io.channels.output
-			//if val != 0 {
-			//	fmt.Println(x, y)
-			//}
-			world[y][x] = val
+			world[y][x] = <-io.channels.output
 		}
 	}
+	return world
+}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
+// outputPath is where a file with the given name is saved, in the output directory.
+func (io *ioState) outputPath(name string) string {
+	dir := io.params.OutDir
+	if dir == "" {
+		dir = defaultOutDir
+	}
+	return filepath.Join(dir, name)
+}
+
+// recordFrame receives an array of bytes and adds it to the animation being recorded as the next frame.
+func (io *ioState) recordFrame() {
+	world := io.receiveWorld()
+	if io.animation == nil && io.recordingErr == nil {
+		io.recordingErr = io.startAnimation()
+	}
+	if io.animation != nil {
+		io.animation.Add(world)
+	}
+}
+
+// startAnimation starts recording to a temporary file in the output directory, so that it can be renamed
+// without being copied once the animation is written.
+func (io *ioState) startAnimation() error {
+	dir := io.outputPath("")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	name := fmt.Sprintf(".recording-%d.gif", time.Now().UnixNano())
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	io.recording = file
+	io.animation = golUtils.NewAnimation(file, io.params.ImageWidth, io.params.ImageHeight, gifDelay)
+	return nil
+}
+
+// writeAnimation finishes the animated gif being recorded and moves it into the output directory, named
+// after the turn the distributor sends, so that the next frame starts a new one. It reports whether that
+// worked like writePgmImage.
+func (io *ioState) writeAnimation() {
+	turn := <-io.channels.turn
+	filename := outputName(io.params, turn)
+	path := io.outputPath(filename + ".gif")
+
+	animation, recording, err := io.animation, io.recording, io.recordingErr
+	io.animation, io.recording, io.recordingErr = nil, nil, nil
+	if err == nil && animation == nil {
+		err = errors.New("no frames have been recorded")
+	}
+	if err == nil {
+		err = finishRecording(animation, recording, path)
+	}
+	io.channels.err <- err
+	if err != nil {
+		return
+	}
+
+	fmt.Println("File", filename, "animation of", animation.Frames(), "frames done!")
+	io.channels.written <- ImageOutputComplete{turn, path}
+}
+
+// finishRecording ends the animation and renames its temporary file to path, removing it if that fails.
+func finishRecording(animation *golUtils.Animation, recording *os.File, path string) error {
+	err := animation.Close()
+	if err == nil {
+		err = recording.Sync()
+	}
+	if closeErr := recording.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(recording.Name(), path)
+	}
+	if err != nil {
+		os.Remove(recording.Name())
+	}
+	return err
+}
+
+// writeImage writes the world to a file in one of the formats Params.Format can be: a raw pgm or pbm
+// image, a png image, or an rle or cells pattern.
+func writeImage(path string, world golUtils.World, format string, rule string) error {
+	switch format {
+	case "pgm", "pbm", "png", "rle", "cells":
+	default:
+		return fmt.Errorf("format %q isn't pgm, pbm, png, rle or cells", format)
+	}
+
+	return writeFile(path, func(file *os.File) error {
+		switch format {
+		case "pgm":
+			return golUtils.WriteNetpbm(file, world, golUtils.RawPGM)
+		case "pbm":
+			return golUtils.WriteNetpbm(file, world, golUtils.RawPBM)
+		case "png":
+			return golUtils.WritePNG(file, world)
+		case "rle":
+			// the rule has already been checked by the time any image is saved
+			parsed, _ := golUtils.ParseRule(rule)
+			return golUtils.WriteRLE(file, world, parsed)
+		default:
+			return golUtils.WriteCells(file, world, strings.TrimSuffix(filepath.Base(path), ".cells"))
 		}
+	})
+}
+
+// writeFile makes the directories a file goes in if needed, then creates it and writes it with write.
+func writeFile(path string, write func(file *os.File) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return err
 	}
+	return file.Sync()
+}
 
-	ioError = file.Sync()
-	util.Check(ioError)
+// ReadImageSize reads the width and height from the header of a pbm or pgm file, so that Params can be
+// made to match an image given by Params.Input before anything is started with them.
+func ReadImageSize(path string) (width, height int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
 
-	fmt.Println("File", filename, "output done!")
+	header, err := golUtils.ReadNetpbmHeader(bufio.NewReader(file))
+	return header.Width, header.Height, err
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
-func (io *ioState) readPgmImage() {
+// IsPattern checks whether a file is an rle or cells pattern, rather than an image. A pattern can be
+// smaller than the world, and is placed in it at Params.Offset.
+func IsPattern(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".rle" || ext == ".cells"
+}
 
-	// Request a filename from the distributor.
-	filename := <-io.channels.filename
+// readPattern reads an rle or cells pattern.
+func readPattern(path string) (golUtils.Pattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return golUtils.Pattern{}, err
+	}
+	defer file.Close()
 
-	data, ioError := ioutil.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
+	var pattern golUtils.Pattern
+	if strings.ToLower(filepath.Ext(path)) == ".rle" {
+		pattern, err = golUtils.ReadRLE(file)
+	} else {
+		pattern, err = golUtils.ReadCells(file)
+	}
+	if err != nil {
+		return pattern, fmt.Errorf("%s: %v", path, err)
+	}
+	return pattern, nil
+}
 
-	fields := strings.Fields(string(data))
+// ReadPatternRule reads the rule from the header of an rle pattern, so that it can be used when no
+// other rule is given. It is empty if the header doesn't give one, and always is for a cells pattern.
+func ReadPatternRule(path string) (string, error) {
+	pattern, err := readPattern(path)
+	return pattern.Rule, err
+}
 
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
+// patternOffset finds where the top left corner of a pattern goes in the world: at Params.Offset,
+// given as x,y, or in the middle of the world if that is left empty.
+func patternOffset(p Params, pattern golUtils.World) (golUtils.CoOrds, error) {
+	if p.Offset == "" {
+		width := 0
+		if len(pattern) > 0 {
+			width = len(pattern[0])
+		}
+		return golUtils.CoOrds{X: (p.ImageWidth - width) / 2, Y: (p.ImageHeight - len(pattern)) / 2}, nil
 	}
 
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+	parts := strings.Split(p.Offset, ",")
+	if len(parts) == 2 {
+		x, errX := strconv.Atoi(strings.TrimSpace(parts[0]))
+		y, errY := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if errX == nil && errY == nil {
+			return golUtils.CoOrds{X: x, Y: y}, nil
+		}
 	}
+	return golUtils.CoOrds{}, fmt.Errorf("offset %q should be x,y", p.Offset)
+}
+
+// readImage reads a pbm or pgm file, which has to be the size given by the params, or places an rle or
+// cells pattern in an otherwise empty world. Grey levels are kept as dying cells for a Generations rule,
+// and are thresholded for any other rule.
+func readImage(path string, p Params) (golUtils.World, error) {
+	var world golUtils.World
+	if IsPattern(path) {
+		pattern, err := readPattern(path)
+		if err != nil {
+			return nil, err
+		}
+		at, err := patternOffset(p, pattern.Cells)
+		if err != nil {
+			return nil, err
+		}
+		world = golUtils.MakeWorld(p.ImageHeight, p.ImageWidth)
+		if err := golUtils.Place(world, pattern.Cells, at); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
 
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+		if world, err = golUtils.ReadNetpbm(file); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
 	}
 
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+	if len(world) != p.ImageHeight || len(world[0]) != p.ImageWidth {
+		return nil, fmt.Errorf("%s is %dx%d rather than %dx%d", path, len(world[0]), len(world), p.ImageWidth, p.ImageHeight)
+	}
+	if rule, err := golUtils.ParseRule(p.Rule); err != nil || rule.States <= 2 {
+		golUtils.Threshold(world)
 	}
+	return world, nil
+}
+
+// readPgmImage opens an image or pattern, reports whether it could be read to the distributor,
+// and if it could sends its data as an array of bytes.
+func (io *ioState) readPgmImage() {
 
-	image := []byte(fields[4])
+	// Request the path of the file from the distributor.
+	filename := <-io.channels.filename
 
-	for _, b := range image {
-		io.channels.input <- b
+	world, err := readImage(filename, io.params)
+	io.channels.err <- err
+	if err != nil {
+		return
+	}
+
+	for _, row := range world {
+		for _, b := range row {
+			io.channels.input <- b
+		}
 	}
 
 	fmt.Println("File", filename, "input done!")
@@ -144,6 +396,10 @@ func startIo(p Params, c ioChannels) {
 				io.writePgmImage()
 			case ioCheckIdle:
 				io.channels.idle <- true
+			case ioFrame:
+				io.recordFrame()
+			case ioAnimation:
+				io.writeAnimation()
 			}
 		}
 	}
@@ -0,0 +1,251 @@
+package gol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// reconnectAttempts is how many times every server is tried before giving up.
+const reconnectAttempts = 3
+
+// session is the distributor's handle on the calculation, which is either run in-process or by a
+// GOL worker or broker. It remembers the last state it has seen, so that if the connection to a
+// server is lost the calculation can carry on from there.
+type session struct {
+	params  Params
+	servers []string
+	current int
+
+	// The calculation is driven through engine, which is remote when there is a server
+	engine engine.Engine
+	remote *engine.Client
+	client *rpc.Client
+
+	// The server can run several calculations at once, id says which one is ours
+	id int
+
+	// Last known state of the world. On the infinite plane the world grows, and origin is where the image is in it.
+	world  golUtils.World
+	origin golUtils.CoOrds
+	turn   int
+}
+
+// newSession takes Params.Server as a comma separated list of servers to fail over between.
+// When it is left empty, e.g. by the tests, the calculation is run in-process instead.
+func newSession(p Params, world golUtils.World) *session {
+	var servers []string
+	if p.Server != "" {
+		servers = strings.Split(p.Server, ",")
+	}
+	return &session{params: p, servers: servers, world: world, id: p.Session}
+}
+
+// isConnectionError tells apart errors from the connection and errors returned by the engine itself.
+func isConnectionError(err error) bool {
+	switch err.(type) {
+	case nil, rpc.ServerError, stubs.ErrorCode:
+		return false
+	default:
+		return true
+	}
+}
+
+// connect dials each server in turn, starting with the current one, until one answers.
+func (s *session) connect() (err error) {
+	if len(s.servers) == 0 {
+		// there is no connection to swamp, so the watcher is shown every turn
+		sim := engine.NewSimulation(engine.LocalBackend)
+		sim.Lockstep()
+		s.engine = sim
+		return
+	}
+	for attempt := 0; attempt < reconnectAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Second)
+		}
+		for i := range s.servers {
+			server := s.servers[(s.current+i)%len(s.servers)]
+			var conn net.Conn
+			conn, err = net.DialTimeout("tcp", server, 2*time.Second)
+			if err == nil {
+				s.current = (s.current + i) % len(s.servers)
+				s.client = rpc.NewClient(conn)
+				s.remote = engine.NewClient(s.client, s.id)
+				s.engine = s.remote
+				fmt.Println("Connected to", server)
+				return
+			}
+		}
+	}
+	return
+}
+
+// frameInterval is how long the watcher waits between asking for flips.
+func (s *session) frameInterval() time.Duration {
+	if s.remote == nil {
+		return 0
+	}
+	return frameInterval
+}
+
+// printPool shows which workers are in the pool if the server is a broker.
+func (s *session) printPool() {
+	if s.client == nil {
+		return
+	}
+	pool := new(stubs.WorkerListResponse)
+	if err := makeCall(s.client, stubs.ListWorkers, stubs.Empty{}, pool); err == nil {
+		for _, worker := range pool.Workers {
+			fmt.Printf("Worker in pool: %s (capacity %d)\n", worker.Address, worker.Capacity)
+		}
+	}
+}
+
+// start loads the last known state into the engine and calculates the remaining turns in the background.
+// The returned channel gets the result once the calculation finishes.
+func (s *session) start() (<-chan error, error) {
+	params, err := workerParams(s.params)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.engine.Load(params, s.world, s.origin, s.turn); err != nil {
+		return nil, err
+	}
+	if s.remote != nil {
+		s.id = s.remote.Session()
+		fmt.Println("Started session", s.id)
+	}
+	return s.background(func() (int, error) { return s.engine.Run(s.params.Turns) }), nil
+}
+
+// background runs a blocking call and sends its error down the returned channel.
+func (s *session) background(call func() (int, error)) <-chan error {
+	finished := make(chan error, 1)
+	go func() {
+		_, err := call()
+		finished <- err
+	}()
+	return finished
+}
+
+// attach picks up a calculation that another controller started and then detached from.
+func (s *session) attach() (finished <-chan error, err error) {
+	if s.remote == nil {
+		err = errors.New("there is no calculation to attach to without a server")
+		return
+	}
+	status, err := s.remote.Attach()
+	if err != nil {
+		return
+	}
+	if status.Params.ImageWidth != s.params.ImageWidth || status.Params.ImageHeight != s.params.ImageHeight {
+		s.remote.Detach()
+		err = fmt.Errorf("server is running a %dx%d world", status.Params.ImageWidth, status.Params.ImageHeight)
+		return
+	}
+	s.params.Turns = status.Params.Turns
+	s.params.Rule = status.Params.Rule.String()
+	s.params.Boundary = status.Params.Boundary.String()
+	s.params.Engine = status.Params.Engine
+
+	if err = s.checkpoint(); err != nil {
+		return
+	}
+	if !status.Calculating {
+		fmt.Println("Calculation has already finished, fetching the final state")
+	}
+
+	finished = s.background(s.remote.Await)
+	return
+}
+
+// checkpoint fetches the current state from the engine and remembers it.
+func (s *session) checkpoint() error {
+	world, origin, turn, err := s.engine.Snapshot()
+	if err != nil {
+		return err
+	}
+	s.world = world
+	s.origin = origin
+	s.turn = turn
+	return nil
+}
+
+// infinite is whether the world is on the infinite plane, where it reaches past the image.
+func (s *session) infinite() bool {
+	boundary, err := golUtils.ParseBoundary(s.params.Boundary)
+	return err == nil && boundary == golUtils.Infinite
+}
+
+// watched takes the state the watcher last showed as the last known state if it is newer, which saves
+// fetching the whole world from the server. On the infinite plane the world reaches past the image the
+// watcher sees, so it has to be checkpointed instead.
+func (s *session) watched(shown golUtils.World, turn int) {
+	if s.infinite() {
+		return
+	}
+	if turn > s.turn {
+		s.world = shown
+		s.origin = golUtils.CoOrds{}
+		s.turn = turn
+	}
+}
+
+// view is the last known state of the part of the world covered by the image.
+func (s *session) view() golUtils.World {
+	return golUtils.View(s.world, s.origin, s.params.ImageWidth, s.params.ImageHeight)
+}
+
+// recover reconnects after the connection has been lost, failing over to the next server if the
+// current one is gone or won't take the world, and resumes the calculation from the last known state.
+func (s *session) recover(events chan<- Event) (finished <-chan error, err error) {
+	if len(s.servers) == 0 {
+		err = errors.New("lost the in-process engine")
+		return
+	}
+	fmt.Println("Lost connection to", s.servers[s.current])
+	events <- StateChange{s.turn, Reconnecting}
+	s.client.Close()
+
+	for i := range s.servers {
+		if i > 0 {
+			s.client.Close()
+			s.current = (s.current + 1) % len(s.servers)
+		}
+		if err = s.connect(); err != nil {
+			return
+		}
+		// the watcher sends the StateChange once it is watching the resumed calculation
+		if finished, err = s.start(); err == nil {
+			fmt.Println("Resumed calculation from turn", s.turn)
+			return
+		}
+	}
+	return
+}
+
+// shutdown tells the server to stop, which can only be done when there is one. It refuses while
+// other controllers' sessions are running, and only our own is stopped.
+func (s *session) shutdown() {
+	if s.client == nil {
+		return
+	}
+	err := makeCall(s.client, stubs.Shutdown, stubs.SessionRequest{Session: s.id}, new(stubs.Empty))
+	if stubs.CodeOf(err) == stubs.Busy {
+		fmt.Println("Server is running other sessions, so it has been left running")
+	}
+}
+
+func (s *session) close() {
+	if s.client != nil {
+		s.client.Close()
+	}
+}
@@ -0,0 +1,157 @@
+package gol
+
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// frameInterval limits how often a remote engine is asked for flips, so a large world can be watched live
+// without the cells that change every turn swamping the connection. Turns in between are skipped.
+const frameInterval = time.Second / 30
+
+// watcher streams the cells that change in the engine to the GUI as CellFlipped and CellShaded events,
+// followed by TurnComplete. It remembers what the GUI is showing, so it can carry on after the
+// calculation is resumed on another server. It also sends a StateChange whenever the server says
+// the calculation has been paused or resumed, by this controller or any other.
+type watcher struct {
+	events chan<- Event
+	shown  golUtils.World
+	turn   int
+	paused bool
+
+	// record is given what the GUI is showing every so many turns, when recording
+	record   func(golUtils.World)
+	every    int
+	recorded int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newWatcher makes a watcher for a GUI that starts off showing a world with every cell dead.
+func newWatcher(events chan<- Event, width, height int) *watcher {
+	return &watcher{events: events, shown: golUtils.MakeWorld(height, width), turn: -1}
+}
+
+// view is a copy of what the GUI is showing and the turn it is of, or -1 if nothing has been shown yet.
+// It must only be used while the watcher isn't running.
+func (w *watcher) view() (golUtils.World, int) {
+	view := golUtils.MakeWorld(len(w.shown), len(w.shown[0]))
+	for y, row := range w.shown {
+		copy(view[y], row)
+	}
+	return view, w.turn
+}
+
+// recordEvery has the watcher give record what the GUI is showing on the first turn it sees at or after each
+// multiple of every, and on the turn the calculation finishes on. recorded is the last turn that has already
+// been recorded, or -1 to record the first turn the watcher sees. A watcher in the same process as the engine
+// sees every turn, but a remote one skips turns to keep up, as does the hashlife engine.
+func (w *watcher) recordEvery(every int, record func(golUtils.World), recorded int) {
+	w.record = record
+	w.every = every
+	w.recorded = recorded
+}
+
+// start watches the engine in the background, asking for flips at most once per interval.
+func (w *watcher) start(e engine.Engine, interval time.Duration) {
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.watch(e, interval)
+}
+
+// halt stops watching straight away, and waits for the watcher to finish.
+func (w *watcher) halt() {
+	if w.done == nil {
+		return
+	}
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	<-w.done
+}
+
+// wait blocks until the watcher has shown the end of the calculation, or given up on it.
+func (w *watcher) wait() {
+	if w.done != nil {
+		<-w.done
+	}
+}
+
+func (w *watcher) watch(e engine.Engine, interval time.Duration) {
+	defer close(w.done)
+	since := -1
+	for {
+		res, err := e.Flips(since, w.paused)
+		if err != nil {
+			// the distributor finds out about the error itself
+			return
+		}
+
+		flips := res.Flips
+		if res.Reset {
+			// the flips are from a blank world, so compare them with what the GUI is actually showing
+			next := golUtils.MakeWorld(len(w.shown), len(w.shown[0]))
+			for _, flip := range flips {
+				next[flip.Cell.Y][flip.Cell.X] = flip.State
+			}
+			flips = golUtils.Diff(w.shown, next)
+		}
+		for _, flip := range flips {
+			w.show(flip, res.CompletedTurns)
+		}
+		if w.record != nil && (w.recorded < 0 || res.CompletedTurns/w.every > w.recorded/w.every ||
+			(res.Finished && res.CompletedTurns > w.recorded)) {
+			w.record(w.shown)
+			w.recorded = res.CompletedTurns
+		}
+		// the first response is the state the watcher started from, rather than a completed turn
+		if since >= 0 && res.CompletedTurns > since {
+			w.events <- TurnComplete{res.CompletedTurns}
+		}
+		// no turns are completed while paused, so it was resumed at the turn it was paused at
+		switch {
+		case res.Paused && (since < 0 || !w.paused):
+			w.events <- StateChange{res.CompletedTurns, Paused}
+		case !res.Paused && since < 0:
+			w.events <- StateChange{res.CompletedTurns, Executing}
+		case !res.Paused && w.paused:
+			w.events <- StateChange{since, Executing}
+		}
+		w.paused = res.Paused
+		since = res.CompletedTurns
+		w.turn = since
+
+		if res.Finished {
+			return
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// show sends the events that change a cell on the GUI from what it is showing to the flip's state.
+func (w *watcher) show(flip golUtils.Flip, turn int) {
+	cell := util.Cell{X: flip.Cell.X, Y: flip.Cell.Y}
+	old := w.shown[cell.Y][cell.X]
+	w.shown[cell.Y][cell.X] = flip.State
+
+	switch {
+	case (old == golUtils.DeadCell || old == golUtils.LiveCell) && (flip.State == golUtils.DeadCell || flip.State == golUtils.LiveCell):
+		w.events <- CellFlipped{turn, cell}
+	case old == golUtils.LiveCell:
+		// an alive cell that starts dying
+		w.events <- CellFlipped{turn, cell}
+		w.events <- CellShaded{turn, cell, flip.State}
+	default:
+		w.events <- CellShaded{turn, cell, flip.State}
+	}
+}
@@ -0,0 +1,253 @@
+package golUtils
+
+import (
+	"errors"
+	"math/bits"
+	"sync"
+)
+
+// bitboardEngine packs 64 cells into each word of a row, with bit i of word j holding cell 64j+i.
+// Each turn a whole word of cells is worked out at once, by adding up the eight words of neighbours
+// with bitwise adders and picking out the neighbour counts that the rule says are alive.
+type bitboardEngine struct {
+	params Params
+	width  int
+	height int
+	// origin is where the image's top left corner is, as the board grows on the infinite plane
+	origin CoOrds
+
+	board [][]uint64
+	next  [][]uint64
+	// Every bit of a row's last word that is in the world
+	lastMask uint64
+
+	// The neighbour counts that give birth and survival, one bit per count
+	born, survive uint16
+}
+
+func checkBitboard(p Params) error {
+	if p.Rule.States > 2 {
+		return errors.New("the bitboard engine only supports life-like rules")
+	}
+	return nil
+}
+
+func newBitboardEngine(p Params, w World, origin CoOrds) *bitboardEngine {
+	e := &bitboardEngine{params: p, born: p.Rule.Birth, survive: p.Rule.Survival}
+	e.load(w, origin)
+	return e
+}
+
+// load packs a world into the board.
+func (e *bitboardEngine) load(w World, origin CoOrds) {
+	e.height = len(w)
+	e.width = len(w[0])
+	e.origin = origin
+	words := (e.width + 63) / 64
+	e.lastMask = ^uint64(0) >> uint(words*64-e.width)
+
+	e.board = make([][]uint64, e.height)
+	e.next = make([][]uint64, e.height)
+	for y, row := range w {
+		e.board[y] = make([]uint64, words)
+		e.next[y] = make([]uint64, words)
+		for x, cell := range row {
+			if cell == LiveCell {
+				e.board[y][x/64] |= 1 << uint(x%64)
+			}
+		}
+	}
+}
+
+func (e *bitboardEngine) cell(row []uint64, x int) uint64 {
+	return row[x/64] >> uint(x%64) & 1
+}
+
+// edges gives the cells just beyond the left and right edges of a row.
+func (e *bitboardEngine) edges(row []uint64) (west, east uint64) {
+	switch e.params.Boundary {
+	case Torus, KleinBottle:
+		return e.cell(row, e.width-1), e.cell(row, 0)
+	case Reflect:
+		return e.cell(row, 0), e.cell(row, e.width-1)
+	default:
+		return 0, 0
+	}
+}
+
+// mirror reverses a row, for the rows beyond the top and bottom of a Klein bottle.
+func (e *bitboardEngine) mirror(row []uint64) []uint64 {
+	mirrored := make([]uint64, len(row))
+	for x := 0; x < e.width; x++ {
+		mirrored[(e.width-1-x)/64] |= e.cell(row, x) << uint((e.width-1-x)%64)
+	}
+	return mirrored
+}
+
+// halos gives the rows just beyond the top and bottom edges.
+func (e *bitboardEngine) halos() (above, below []uint64) {
+	switch e.params.Boundary {
+	case Torus:
+		return e.board[e.height-1], e.board[0]
+	case Reflect:
+		return e.board[0], e.board[e.height-1]
+	case KleinBottle:
+		return e.mirror(e.board[e.height-1]), e.mirror(e.board[0])
+	default:
+		empty := make([]uint64, len(e.board[0]))
+		return empty, empty
+	}
+}
+
+// shifted gives the words of a row moved one cell along, so that bit i of west holds the cell to the
+// left of cell i, and bit i of east holds the cell to its right.
+func (e *bitboardEngine) shifted(row []uint64, i int, westEdge, eastEdge uint64) (west, east uint64) {
+	last := len(row) - 1
+	west = row[i] << 1
+	if i > 0 {
+		west |= row[i-1] >> 63
+	} else {
+		west |= westEdge
+	}
+	east = row[i] >> 1
+	if i < last {
+		east |= row[i+1] << 63
+	} else {
+		east |= eastEdge << uint((e.width-1)%64)
+	}
+	return
+}
+
+// add is a full adder working on 64 bits at once.
+func add(a, b, c uint64) (sum, carry uint64) {
+	sum = a ^ b ^ c
+	carry = a&b | c&(a^b)
+	return
+}
+
+// nextWord works out the next state of a word of cells from its eight neighbours.
+func (e *bitboardEngine) nextWord(cells, nw, n, ne, w, east, sw, s, se uint64) uint64 {
+	// add the neighbours up into a 4 bit count for each cell, held as the bits ones, twos, fours and eights
+	sumA, carryA := add(nw, n, ne)
+	sumB, carryB := add(w, east, sw)
+	sumC, carryC := s^se, s&se
+	ones, carryD := add(sumA, sumB, sumC)
+	pairs, carryE := add(carryA, carryB, carryC)
+	twos, carryF := pairs^carryD, pairs&carryD
+	fours, eights := carryE^carryF, carryE&carryF
+
+	var born, survive uint64
+	for count := uint(0); count <= 8; count++ {
+		if (e.born|e.survive)&(1<<count) == 0 {
+			continue
+		}
+		match := ^uint64(0)
+		for bit, plane := range [4]uint64{ones, twos, fours, eights} {
+			if count&(1<<uint(bit)) != 0 {
+				match &= plane
+			} else {
+				match &= ^plane
+			}
+		}
+		if e.born&(1<<count) != 0 {
+			born |= match
+		}
+		if e.survive&(1<<count) != 0 {
+			survive |= match
+		}
+	}
+	return cells&survive | ^cells&born
+}
+
+// stepRows works out the next state of the rows from start to end.
+func (e *bitboardEngine) stepRows(start, end int, above, below []uint64) {
+	for y := start; y < end; y++ {
+		up, row, down := above, e.board[y], below
+		if y > 0 {
+			up = e.board[y-1]
+		}
+		if y < e.height-1 {
+			down = e.board[y+1]
+		}
+		upWest, upEast := e.edges(up)
+		rowWest, rowEast := e.edges(row)
+		downWest, downEast := e.edges(down)
+
+		next := e.next[y]
+		for i := range row {
+			nw, ne := e.shifted(up, i, upWest, upEast)
+			w, east := e.shifted(row, i, rowWest, rowEast)
+			sw, se := e.shifted(down, i, downWest, downEast)
+			next[i] = e.nextWord(row[i], nw, up[i], ne, w, east, sw, down[i], se)
+		}
+		next[len(next)-1] &= e.lastMask
+	}
+}
+
+// liveOnEdge checks whether any cell on the edges is alive, so the board needs to grow on the infinite plane.
+func (e *bitboardEngine) liveOnEdge() bool {
+	for _, row := range [][]uint64{e.board[0], e.board[e.height-1]} {
+		for _, word := range row {
+			if word != 0 {
+				return true
+			}
+		}
+	}
+	for _, row := range e.board {
+		if e.cell(row, 0) != 0 || e.cell(row, e.width-1) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *bitboardEngine) Step(turns int) int {
+	if e.params.Boundary == Infinite && e.liveOnEdge() {
+		w, origin := e.World()
+		e.load(Grow(w, origin))
+	}
+
+	above, below := e.halos()
+	threads := e.params.Threads
+	if threads > e.height {
+		threads = e.height
+	}
+	if threads < 1 {
+		threads = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e.stepRows(i*e.height/threads, (i+1)*e.height/threads, above, below)
+		}(i)
+	}
+	wg.Wait()
+
+	e.board, e.next = e.next, e.board
+	return 1
+}
+
+func (e *bitboardEngine) World() (World, CoOrds) {
+	w := MakeWorld(e.height, e.width)
+	for y, row := range e.board {
+		for x := range w[y] {
+			if e.cell(row, x) != 0 {
+				w[y][x] = LiveCell
+			}
+		}
+	}
+	return w, e.origin
+}
+
+func (e *bitboardEngine) AliveCells() int {
+	alive := 0
+	for _, row := range e.board {
+		for _, word := range row {
+			alive += bits.OnesCount64(word)
+		}
+	}
+	return alive
+}
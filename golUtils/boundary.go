@@ -0,0 +1,166 @@
+package golUtils
+
+import (
+	"errors"
+	"strings"
+)
+
+// Boundary says what lies beyond the edges of the world.
+type Boundary int
+
+const (
+	// Torus wraps each edge around to the opposite one.
+	Torus Boundary = iota
+	// DeadEdges treats every cell beyond the edges as dead.
+	DeadEdges
+	// Reflect mirrors the world at its edges, so the cell beyond an edge is the cell on it.
+	Reflect
+	// KleinBottle wraps the left and right edges like a torus, but the top and bottom edges
+	// are joined with a half twist, so a cell leaving the top comes back mirrored at the bottom.
+	KleinBottle
+	// Infinite is an unbounded plane. The world grows whenever a cell comes alive on its edge.
+	Infinite
+)
+
+var boundaryNames = []string{"torus", "dead", "reflect", "klein", "infinite"}
+
+// ParseBoundary reads a boundary by name. An empty string gives a torus.
+func ParseBoundary(s string) (Boundary, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return Torus, nil
+	}
+	for i, name := range boundaryNames {
+		if s == name {
+			return Boundary(i), nil
+		}
+	}
+	return Torus, errors.New("boundary should be one of " + strings.Join(boundaryNames, ", "))
+}
+
+func (b Boundary) String() string {
+	if b < 0 || int(b) >= len(boundaryNames) {
+		return "unknown"
+	}
+	return boundaryNames[b]
+}
+
+// locate finds the cell at (x, y), which can be one cell beyond an edge of a world of the given size.
+// It returns false if the cell is beyond an edge and dead.
+func (b Boundary) locate(width, height, x, y int) (int, int, bool) {
+	if x >= 0 && x < width && y >= 0 && y < height {
+		return x, y, true
+	}
+
+	switch b {
+	case Torus:
+		return (x + width) % width, (y + height) % height, true
+	case Reflect:
+		return clamp(x, width), clamp(y, height), true
+	case KleinBottle:
+		if y < 0 || y >= height {
+			y = (y + height) % height
+			x = width - 1 - x
+		}
+		return (x + width) % width, y, true
+	default:
+		// the infinite plane is grown before each turn, so its edges are dead too
+		return 0, 0, false
+	}
+}
+
+func clamp(i, size int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= size {
+		return size - 1
+	}
+	return i
+}
+
+// RowAt returns row y of the world, where y can be one row beyond the top or bottom edge.
+// It is used to give a strip of the world the halo rows it needs at the edges.
+func RowAt(p Params, w World, y int) []byte {
+	height := len(w)
+	if y >= 0 && y < height {
+		return w[y]
+	}
+
+	switch p.Boundary {
+	case Torus:
+		return w[(y+height)%height]
+	case Reflect:
+		return w[clamp(y, height)]
+	case KleinBottle:
+		row := w[(y+height)%height]
+		mirrored := make([]byte, len(row))
+		for x, cell := range row {
+			mirrored[len(row)-1-x] = cell
+		}
+		return mirrored
+	default:
+		return make([]byte, len(w[0]))
+	}
+}
+
+// growMargin is how far the world grows at once on the infinite plane, so it doesn't have to grow every turn.
+const growMargin = 16
+
+// Grow makes sure a world on the infinite plane has no alive cells on its edges, so that treating
+// everything beyond the edges as dead gives the right next state. Origin is the position in the world
+// of the top left corner of the original image, and is moved along with the cells.
+func Grow(w World, origin CoOrds) (World, CoOrds) {
+	height := len(w)
+	width := len(w[0])
+
+	var top, bottom, left, right int
+	for x := 0; x < width; x++ {
+		if w[0][x] == LiveCell {
+			top = growMargin
+		}
+		if w[height-1][x] == LiveCell {
+			bottom = growMargin
+		}
+	}
+	for y := 0; y < height; y++ {
+		if w[y][0] == LiveCell {
+			left = growMargin
+		}
+		if w[y][width-1] == LiveCell {
+			right = growMargin
+		}
+	}
+	if top+bottom+left+right == 0 {
+		return w, origin
+	}
+
+	grown := MakeWorld(height+top+bottom, width+left+right)
+	for y, row := range w {
+		copy(grown[y+top][left:], row)
+	}
+	return grown, CoOrds{X: origin.X + left, Y: origin.Y + top}
+}
+
+// View crops the original image back out of a world that may have grown on the infinite plane.
+func View(w World, origin CoOrds, width, height int) World {
+	if origin.X == 0 && origin.Y == 0 && len(w) == height && len(w[0]) == width {
+		return w
+	}
+
+	view := make(World, height)
+	for y := range view {
+		view[y] = w[origin.Y+y][origin.X : origin.X+width]
+	}
+	return view
+}
+
+// NextWorld advances a whole world by one turn, growing it first if it is on the infinite plane.
+func NextWorld(p Params, w World, origin CoOrds) (World, CoOrds) {
+	if p.Boundary == Infinite {
+		w, origin = Grow(w, origin)
+	}
+	p.ImageHeight = len(w)
+	p.ImageWidth = len(w[0])
+	return CalculateNextState(p, w, CoOrds{X: 0, Y: 0}, CoOrds{X: p.ImageWidth, Y: p.ImageHeight}), origin
+}
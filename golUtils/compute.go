@@ -0,0 +1,80 @@
+package golUtils
+
+import "sync"
+
+func calculateAliveNeighbours(p Params, w World, x int, y int) int {
+	var aliveNeighbours int
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			checkX, checkY, ok := p.Boundary.locate(p.ImageWidth, p.ImageHeight, x+dx, y+dy)
+			if ok && w[checkY][checkX] == LiveCell {
+				aliveNeighbours++
+			}
+		}
+	}
+
+	return aliveNeighbours
+}
+
+// CalculateNextSectionState returns the next state of the cells between startCoords and endCoords
+// on a single goroutine, using the rule and boundary in p. The edges of the world are given by p.
+func CalculateNextSectionState(p Params, w World, startCoords CoOrds, endCoords CoOrds) World {
+	newWorldSlice := MakeWorld(endCoords.Y-startCoords.Y, endCoords.X-startCoords.X)
+	for y := startCoords.Y; y < endCoords.Y; y++ {
+		for x := startCoords.X; x < endCoords.X; x++ {
+
+			livingNeighbours := calculateAliveNeighbours(p, w, x, y)
+
+			newWorldSlice[y-startCoords.Y][x-startCoords.X] = p.Rule.NextCell(w[y][x], livingNeighbours)
+		}
+	}
+	return newWorldSlice
+}
+
+// CalculateNextState does the same as CalculateNextSectionState, but splits the rows into
+// p.Threads strips and calculates each strip on its own goroutine.
+func CalculateNextState(p Params, w World, startCoords CoOrds, endCoords CoOrds) World {
+	rows := endCoords.Y - startCoords.Y
+	threads := p.Threads
+	if threads > rows {
+		threads = rows
+	}
+	if threads <= 1 {
+		return CalculateNextSectionState(p, w, startCoords, endCoords)
+	}
+
+	// the strips differ in height by at most one row
+	strips := make([]World, threads)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		start := CoOrds{X: startCoords.X, Y: startCoords.Y + i*rows/threads}
+		end := CoOrds{X: endCoords.X, Y: startCoords.Y + (i+1)*rows/threads}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			strips[i] = CalculateNextSectionState(p, w, start, end)
+		}(i)
+	}
+	wg.Wait()
+
+	newWorld := make(World, 0, rows)
+	for _, strip := range strips {
+		newWorld = append(newWorld, strip...)
+	}
+	return newWorld
+}
+
+func CountCells(w World) int {
+	liveCount := 0
+	for _, row := range w {
+		for _, cell := range row {
+			if cell == LiveCell {
+				liveCount++
+			}
+		}
+	}
+	return liveCount
+}
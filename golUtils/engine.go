@@ -0,0 +1,74 @@
+package golUtils
+
+import (
+	"errors"
+	"strings"
+)
+
+// Engine calculates turns of a whole world. Engines can store the world however suits them,
+// so the world is only turned back into a dense World when it is asked for.
+type Engine interface {
+	// Step advances the world by at least one turn and at most turns turns, and returns how many
+	// turns it advanced. Most engines advance one turn at a time, but hashlife jumps further ahead.
+	Step(turns int) int
+	// World returns the current state, along with where the image's top left corner is in it.
+	// The world mustn't be changed, as an engine may keep using it.
+	World() (World, CoOrds)
+	// AliveCells counts the cells that are currently alive.
+	AliveCells() int
+}
+
+// EngineNames lists the engines NewEngine can make. The first one is used when Params.Engine is empty.
+var EngineNames = []string{"dense", "sparse", "hashlife", "bitboard"}
+
+// CheckEngine makes sure the engine named by p.Engine exists and can run the rule and boundary in p.
+func CheckEngine(p Params) error {
+	switch p.Engine {
+	case "", "dense", "sparse":
+		return nil
+	case "hashlife":
+		return checkHashlife(p)
+	case "bitboard":
+		return checkBitboard(p)
+	default:
+		return errors.New("engine should be one of " + strings.Join(EngineNames, ", "))
+	}
+}
+
+// NewEngine makes the engine named by p.Engine, loaded with a world. Origin is where the
+// image's top left corner is in the world, which is only ever away from (0, 0) on the infinite plane.
+func NewEngine(p Params, w World, origin CoOrds) (Engine, error) {
+	if err := CheckEngine(p); err != nil {
+		return nil, err
+	}
+	switch p.Engine {
+	case "sparse":
+		return newSparseEngine(p, w, origin), nil
+	case "hashlife":
+		return newHashlifeEngine(p, w, origin), nil
+	case "bitboard":
+		return newBitboardEngine(p, w, origin), nil
+	default:
+		return &denseEngine{params: p, world: w, origin: origin}, nil
+	}
+}
+
+// denseEngine stores every cell of the world, and splits each turn across p.Threads goroutines.
+type denseEngine struct {
+	params Params
+	world  World
+	origin CoOrds
+}
+
+func (e *denseEngine) Step(turns int) int {
+	e.world, e.origin = NextWorld(e.params, e.world, e.origin)
+	return 1
+}
+
+func (e *denseEngine) World() (World, CoOrds) {
+	return e.world, e.origin
+}
+
+func (e *denseEngine) AliveCells() int {
+	return CountCells(e.world)
+}
@@ -10,6 +10,9 @@ type Params struct {
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+	Rule        Rule
+	Boundary    Boundary
+	Engine      string
 }
 
 type CoOrds struct {
@@ -30,3 +33,22 @@ func MakeImmutableWorld(w World) func(y, x int) uint8 {
 		return w[y][x]
 	}
 }
+
+// Flip is a cell that has changed, along with the state it has changed to.
+type Flip struct {
+	Cell  CoOrds
+	State byte
+}
+
+// Diff lists the cells that differ between two worlds of the same size. A nil old world counts as all dead.
+func Diff(old, new World) []Flip {
+	var flips []Flip
+	for y, row := range new {
+		for x, cell := range row {
+			if (old == nil && cell != DeadCell) || (old != nil && old[y][x] != cell) {
+				flips = append(flips, Flip{Cell: CoOrds{X: x, Y: y}, State: cell})
+			}
+		}
+	}
+	return flips
+}
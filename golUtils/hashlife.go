@@ -0,0 +1,416 @@
+package golUtils
+
+import "errors"
+
+// node is a square of 2^level by 2^level cells, split into four quadrants of the level below.
+// Nodes are never changed once made, and each distinct square is only made once, so repeated
+// parts of the world, in space or in time, share the same node and the same results.
+type node struct {
+	nw, ne, sw, se *node
+	level          uint
+	population     int
+}
+
+// resultKey looks up the centre of a node after 2^step turns.
+type resultKey struct {
+	n    *node
+	step uint
+}
+
+const (
+	// hashlifeMaxNodes is how many nodes are kept before the ones the current world doesn't use are thrown away.
+	hashlifeMaxNodes = 1 << 20
+	// hashlifeMaxStep is the furthest the engine jumps in one go, as a power of two.
+	hashlifeMaxStep = 62
+	// hashlifeMargin is how far around the image World looks for cells on the infinite plane.
+	hashlifeMargin = 256
+)
+
+// hashlifeEngine stores the world as a quadtree of shared nodes, and memoises the result of every
+// node it calculates. Once the world settles into repeating patterns it can jump ahead by billions
+// of turns at a time.
+//
+// A bounded world is unfolded into a torus: reflecting edges mirror it into a torus twice the size,
+// and a Klein bottle is a torus twice the height with the second half mirrored. The torus is then
+// tiled over the plane, which only works when its width and height are powers of two.
+type hashlifeEngine struct {
+	params Params
+
+	nodes   map[[4]*node]*node
+	results map[resultKey]*node
+	leaves  [2]*node
+	empty   []*node
+	// The next 2x2 centre of every 4x4 square, indexed by its cells' bits
+	centres [1 << 16]*node
+
+	root *node
+	// corner is where the root's top left cell is, relative to the image's top left corner.
+	// On a bounded world the root is the torus, tiled to fill a square, with its corner on the image's.
+	corner CoOrds
+	// copies is how many times the image fits into a bounded world's root
+	copies int
+
+	// log2 of how many turns the next jump goes
+	step uint
+}
+
+func checkHashlife(p Params) error {
+	if p.Rule.States > 2 {
+		return errors.New("the hashlife engine only supports life-like rules")
+	}
+	switch p.Boundary {
+	case DeadEdges:
+		return errors.New("the hashlife engine doesn't support dead edges")
+	case Infinite:
+		if p.Rule.Birth&1 != 0 {
+			return errors.New("the hashlife engine can't run a rule with B0 on the infinite plane")
+		}
+	default:
+		if !isPowerOfTwo(p.ImageWidth) || !isPowerOfTwo(p.ImageHeight) {
+			return errors.New("the hashlife engine needs the width and height to be powers of two, except on the infinite plane")
+		}
+	}
+	return nil
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+func newHashlifeEngine(p Params, w World, origin CoOrds) *hashlifeEngine {
+	e := &hashlifeEngine{params: p}
+	e.reset()
+	e.leaves = [2]*node{{population: 0}, {population: 1}}
+
+	if p.Boundary == Infinite {
+		size := len(w)
+		if len(w[0]) > size {
+			size = len(w[0])
+		}
+		e.root = e.build(8, size, func(x, y int) byte {
+			if y < len(w) && x < len(w[0]) {
+				return w[y][x]
+			}
+			return DeadCell
+		})
+		e.corner = CoOrds{X: -origin.X, Y: -origin.Y}
+		return e
+	}
+
+	width, height := p.ImageWidth, p.ImageHeight
+	unfolded := func(x, y int) byte { return w[y%height][x%width] }
+	switch p.Boundary {
+	case Reflect:
+		width, height = width*2, height*2
+		unfolded = func(x, y int) byte {
+			x, y = x%width, y%height
+			if x >= p.ImageWidth {
+				x = width - 1 - x
+			}
+			if y >= p.ImageHeight {
+				y = height - 1 - y
+			}
+			return w[y][x]
+		}
+	case KleinBottle:
+		height *= 2
+		unfolded = func(x, y int) byte {
+			x, y = x%width, y%height
+			if y >= p.ImageHeight {
+				x, y = width-1-x, y-p.ImageHeight
+			}
+			return w[y][x]
+		}
+	}
+	size := width
+	if height > size {
+		size = height
+	}
+	e.root = e.build(1, size, unfolded)
+	e.copies = size * size / (p.ImageWidth * p.ImageHeight)
+	return e
+}
+
+// reset throws away every node and result, which is done before the memory they use gets too big.
+func (e *hashlifeEngine) reset() {
+	e.nodes = make(map[[4]*node]*node)
+	e.results = make(map[resultKey]*node)
+	e.empty = nil
+	e.centres = [1 << 16]*node{}
+}
+
+// build makes a node holding a square of cells, at least minSize and size wide.
+func (e *hashlifeEngine) build(minSize, size int, cell func(x, y int) byte) *node {
+	var level uint
+	for 1<<level < size || 1<<level < minSize {
+		level++
+	}
+	var grow func(x, y int, level uint) *node
+	grow = func(x, y int, level uint) *node {
+		if level == 0 {
+			if cell(x, y) == LiveCell {
+				return e.leaves[1]
+			}
+			return e.leaves[0]
+		}
+		half := 1 << (level - 1)
+		return e.join(grow(x, y, level-1), grow(x+half, y, level-1), grow(x, y+half, level-1), grow(x+half, y+half, level-1))
+	}
+	return grow(0, 0, level)
+}
+
+// join finds the node made of four quadrants, making it if it doesn't exist yet.
+func (e *hashlifeEngine) join(nw, ne, sw, se *node) *node {
+	key := [4]*node{nw, ne, sw, se}
+	if n, ok := e.nodes[key]; ok {
+		return n
+	}
+	n := &node{nw: nw, ne: ne, sw: sw, se: se, level: nw.level + 1,
+		population: nw.population + ne.population + sw.population + se.population}
+	e.nodes[key] = n
+	return n
+}
+
+func (e *hashlifeEngine) emptyNode(level uint) *node {
+	if len(e.empty) == 0 {
+		e.empty = append(e.empty, e.leaves[0])
+	}
+	for uint(len(e.empty)) <= level {
+		below := e.empty[len(e.empty)-1]
+		e.empty = append(e.empty, e.join(below, below, below, below))
+	}
+	return e.empty[level]
+}
+
+// centre is the middle half of a node.
+func (e *hashlifeEngine) centre(n *node) *node {
+	return e.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// quarterBits gives the four cells of a level 1 node as bits, in reading order.
+func quarterBits(n *node) int {
+	return n.nw.population | n.ne.population<<1 | n.sw.population<<2 | n.se.population<<3
+}
+
+// nextCentre works out the middle 2x2 cells of a 4x4 node after one turn.
+func (e *hashlifeEngine) nextCentre(n *node) *node {
+	bits := quarterBits(n.nw) | quarterBits(n.ne)<<4 | quarterBits(n.sw)<<8 | quarterBits(n.se)<<12
+	if centre := e.centres[bits]; centre != nil {
+		return centre
+	}
+
+	cell := func(x, y int) int {
+		quadrant := y/2*2 + x/2
+		return bits >> uint(quadrant*4+y%2*2+x%2) & 1
+	}
+	var next [4]*node
+	for i := range next {
+		x, y := 1+i%2, 1+i/2
+		aliveNeighbours := 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if dx != 0 || dy != 0 {
+					aliveNeighbours += cell(x+dx, y+dy)
+				}
+			}
+		}
+		state := DeadCell
+		if cell(x, y) == 1 {
+			state = LiveCell
+		}
+		next[i] = e.leaves[0]
+		if e.params.Rule.NextCell(state, aliveNeighbours) == LiveCell {
+			next[i] = e.leaves[1]
+		}
+	}
+	centre := e.join(next[0], next[1], next[2], next[3])
+	e.centres[bits] = centre
+	return centre
+}
+
+// successor is the centre of a node after 2^step turns, where step is at most the node's level - 2.
+func (e *hashlifeEngine) successor(n *node, step uint) *node {
+	if n.population == 0 && e.params.Rule.Birth&1 == 0 {
+		return e.emptyNode(n.level - 1)
+	}
+	key := resultKey{n, step}
+	if result, ok := e.results[key]; ok {
+		return result
+	}
+
+	var result *node
+	if n.level == 2 {
+		result = e.nextCentre(n)
+	} else {
+		// the nine overlapping nodes of the level below, spread evenly across n
+		sub := [9]*node{
+			n.nw, e.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), n.ne,
+			e.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne), e.centre(n), e.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne),
+			n.sw, e.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), n.se,
+		}
+		// at full speed both halves of the jump are made here, otherwise the first half is skipped
+		full := step == n.level-2
+		for i, s := range sub {
+			if full {
+				sub[i] = e.successor(s, step-1)
+			} else {
+				sub[i] = e.centre(s)
+			}
+		}
+		if full {
+			step--
+		}
+		result = e.join(
+			e.successor(e.join(sub[0], sub[1], sub[3], sub[4]), step),
+			e.successor(e.join(sub[1], sub[2], sub[4], sub[5]), step),
+			e.successor(e.join(sub[3], sub[4], sub[6], sub[7]), step),
+			e.successor(e.join(sub[4], sub[5], sub[7], sub[8]), step))
+	}
+	e.results[key] = result
+	return result
+}
+
+// expand puts an empty border around the root, doubling its size.
+func (e *hashlifeEngine) expand() {
+	r := e.root
+	border := e.emptyNode(r.level - 1)
+	e.root = e.join(
+		e.join(border, border, border, r.nw),
+		e.join(border, border, r.ne, border),
+		e.join(border, r.sw, border, border),
+		e.join(r.se, border, border, border))
+	half := 1 << (r.level - 1)
+	e.corner = CoOrds{X: e.corner.X - half, Y: e.corner.Y - half}
+}
+
+// jump advances the world by 2^step turns.
+func (e *hashlifeEngine) jump(step uint) {
+	if e.params.Boundary == Infinite {
+		// nothing can travel further than one cell a turn, so once every cell is in the middle of a root
+		// at least 2^(step+2) wide, and then the root is doubled, none can leave the successor's area
+		for e.root.level < step+3 || e.centre(e.root).population != e.root.population {
+			e.expand()
+		}
+		e.expand()
+		quarter := 1 << (e.root.level - 2)
+		e.root = e.successor(e.root, step)
+		e.corner = CoOrds{X: e.corner.X + quarter, Y: e.corner.Y + quarter}
+		return
+	}
+
+	// the torus tiled out to twice its size and more gives it back after the jump, a quarter of the
+	// way in, which is a whole number of tiles across
+	tile := e.root
+	tiled := tile
+	for tiled.level < tile.level+2 || tiled.level < step+2 {
+		tiled = e.join(tiled, tiled, tiled, tiled)
+	}
+	result := e.successor(tiled, step)
+	for result.level > tile.level {
+		result = result.nw
+	}
+	e.root = result
+}
+
+// Step jumps 2^step turns, where step goes up by one every jump until it reaches the turns that are left.
+// Each jump is then about as long as all of the jumps before it, so pausing and counting cells never
+// have to wait for much longer than the run has taken so far, and the same turns are always stepped to.
+func (e *hashlifeEngine) Step(turns int) int {
+	step := e.step
+	for step > 0 && 1<<step > turns {
+		step--
+	}
+
+	e.jump(step)
+	if step == e.step && e.step < hashlifeMaxStep {
+		e.step++
+	}
+
+	if len(e.nodes) > hashlifeMaxNodes {
+		e.collect()
+	}
+	return 1 << step
+}
+
+// collect throws away every node and result, apart from the nodes that make up the current world.
+func (e *hashlifeEngine) collect() {
+	e.reset()
+	copied := make(map[*node]*node)
+	var rebuild func(n *node) *node
+	rebuild = func(n *node) *node {
+		if n.level == 0 {
+			return n
+		}
+		if c, ok := copied[n]; ok {
+			return c
+		}
+		c := e.join(rebuild(n.nw), rebuild(n.ne), rebuild(n.sw), rebuild(n.se))
+		copied[n] = c
+		return c
+	}
+	e.root = rebuild(e.root)
+}
+
+// cells calls found for every alive cell of n within the rectangle from min to max, exclusive.
+// corner is where n's top left cell is.
+func cells(n *node, corner, min, max CoOrds, found func(x, y int)) {
+	size := 1 << n.level
+	if n.population == 0 || corner.X >= max.X || corner.Y >= max.Y || corner.X+size <= min.X || corner.Y+size <= min.Y {
+		return
+	}
+	if n.level == 0 {
+		found(corner.X, corner.Y)
+		return
+	}
+	half := size / 2
+	cells(n.nw, corner, min, max, found)
+	cells(n.ne, CoOrds{X: corner.X + half, Y: corner.Y}, min, max, found)
+	cells(n.sw, CoOrds{X: corner.X, Y: corner.Y + half}, min, max, found)
+	cells(n.se, CoOrds{X: corner.X + half, Y: corner.Y + half}, min, max, found)
+}
+
+// World makes a dense world of the image. On the infinite plane it is grown to take in the cells
+// around the image too, but only up to hashlifeMargin away, as a pattern can have spread too far to draw.
+func (e *hashlifeEngine) World() (World, CoOrds) {
+	width, height := e.params.ImageWidth, e.params.ImageHeight
+	if e.params.Boundary != Infinite {
+		w := MakeWorld(height, width)
+		cells(e.root, e.corner, CoOrds{}, CoOrds{X: width, Y: height}, func(x, y int) {
+			w[y][x] = LiveCell
+		})
+		return w, CoOrds{}
+	}
+
+	var alive []CoOrds
+	minX, minY := 0, 0
+	maxX, maxY := width-1, height-1
+	cells(e.root, e.corner, CoOrds{X: -hashlifeMargin, Y: -hashlifeMargin}, CoOrds{X: width + hashlifeMargin, Y: height + hashlifeMargin}, func(x, y int) {
+		alive = append(alive, CoOrds{X: x, Y: y})
+		if x < minX {
+			minX = x
+		}
+		if y < minY {
+			minY = y
+		}
+		if x > maxX {
+			maxX = x
+		}
+		if y > maxY {
+			maxY = y
+		}
+	})
+
+	w := MakeWorld(maxY-minY+1, maxX-minX+1)
+	for _, c := range alive {
+		w[c.Y-minY][c.X-minX] = LiveCell
+	}
+	return w, CoOrds{X: -minX, Y: -minY}
+}
+
+// AliveCells counts every alive cell, which on a bounded world is the root's population shared between its copies of the image.
+func (e *hashlifeEngine) AliveCells() int {
+	if e.params.Boundary == Infinite {
+		return e.root.population
+	}
+	return e.root.population / e.copies
+}
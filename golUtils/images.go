@@ -0,0 +1,140 @@
+package golUtils
+
+import (
+	"bufio"
+	"compress/lzw"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// greys is a palette of every grey level, so that a cell's level is its index in the palette and the
+// dying cells of a Generations rule keep their levels in a GIF, as they do in a PGM image.
+var greys = func() color.Palette {
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.Gray{Y: uint8(i)}
+	}
+	return palette
+}()
+
+// WritePNG writes a world as a greyscale PNG image, with alive cells in white.
+func WritePNG(w io.Writer, world World) error {
+	height := len(world)
+	width := 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y, row := range world {
+		copy(img.Pix[y*img.Stride:], row)
+	}
+	return png.Encode(w, img)
+}
+
+// Animation writes worlds as the frames of an animated GIF, which loops forever. Each frame is encoded
+// as soon as it is added, so however long the recording is, only the frame being added is in memory.
+type Animation struct {
+	writer *bufio.Writer
+	width  int
+	height int
+	delay  int
+	frames int
+}
+
+// NewAnimation starts an animated GIF of worlds of the given size, showing each frame for delay
+// hundredths of a second. Close has to be called once the last frame has been added.
+func NewAnimation(w io.Writer, width, height, delay int) *Animation {
+	a := &Animation{writer: bufio.NewWriter(w), width: width, height: height, delay: delay}
+
+	// the header and logical screen, with the palette of greys as the global colour table
+	a.writer.WriteString("GIF89a")
+	a.writeUint16(width)
+	a.writeUint16(height)
+	a.writer.Write([]byte{0xf7, 0, 0})
+	for _, grey := range greys {
+		level := grey.(color.Gray).Y
+		a.writer.Write([]byte{level, level, level})
+	}
+
+	// the Netscape extension that makes it loop forever
+	a.writer.Write([]byte{0x21, 0xff, 11})
+	a.writer.WriteString("NETSCAPE2.0")
+	a.writer.Write([]byte{3, 1, 0, 0, 0})
+	return a
+}
+
+func (a *Animation) writeUint16(n int) {
+	a.writer.Write([]byte{byte(n), byte(n >> 8)})
+}
+
+// Add encodes the world as the next frame. Errors writing it are returned by Close.
+func (a *Animation) Add(world World) {
+	// the graphic control extension, which gives the frame's delay
+	a.writer.Write([]byte{0x21, 0xf9, 4, 0})
+	a.writeUint16(a.delay)
+	a.writer.Write([]byte{0, 0})
+
+	// the image descriptor, covering the whole screen and using the global colour table
+	a.writer.WriteByte(0x2c)
+	a.writeUint16(0)
+	a.writeUint16(0)
+	a.writeUint16(a.width)
+	a.writeUint16(a.height)
+	a.writer.WriteByte(0)
+
+	// the cells are their own palette indices, compressed with 8 bit LZW and split into sub-blocks
+	a.writer.WriteByte(8)
+	blocks := &blockWriter{writer: a.writer}
+	compressor := lzw.NewWriter(blocks, lzw.LSB, 8)
+	for _, row := range world {
+		compressor.Write(row)
+	}
+	compressor.Close()
+	blocks.close()
+	a.frames++
+}
+
+// Frames is the number of frames added so far.
+func (a *Animation) Frames() int {
+	return a.frames
+}
+
+// Close ends the GIF and returns any error writing it.
+func (a *Animation) Close() error {
+	a.writer.WriteByte(0x3b)
+	return a.writer.Flush()
+}
+
+// blockWriter splits a GIF's image data into sub-blocks of up to 255 bytes, each preceded by its length.
+type blockWriter struct {
+	writer *bufio.Writer
+	block  [256]byte
+	length int
+}
+
+func (b *blockWriter) Write(data []byte) (int, error) {
+	for _, d := range data {
+		b.length++
+		b.block[b.length] = d
+		if b.length == 255 {
+			b.flush()
+		}
+	}
+	return len(data), nil
+}
+
+func (b *blockWriter) flush() {
+	if b.length > 0 {
+		b.block[0] = byte(b.length)
+		b.writer.Write(b.block[:b.length+1])
+		b.length = 0
+	}
+}
+
+// close writes the last sub-block and then the empty block that ends the image data.
+func (b *blockWriter) close() {
+	b.flush()
+	b.writer.WriteByte(0)
+}
@@ -0,0 +1,274 @@
+package golUtils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The Netpbm formats that can be read and written. Cells have no colour, so only the bitmap (PBM)
+// and greymap (PGM) formats are supported, as plain ASCII or raw binary.
+const (
+	PlainPBM = "P1"
+	PlainPGM = "P2"
+	RawPBM   = "P4"
+	RawPGM   = "P5"
+)
+
+// NetpbmHeader describes a Netpbm image. Maxval is the value of a white pixel, which is always 1 for a bitmap.
+type NetpbmHeader struct {
+	Format string
+	Width  int
+	Height int
+	Maxval int
+}
+
+func (h NetpbmHeader) bitmap() bool {
+	return h.Format == PlainPBM || h.Format == RawPBM
+}
+
+func (h NetpbmHeader) plain() bool {
+	return h.Format == PlainPBM || h.Format == PlainPGM
+}
+
+// isSpace checks for the whitespace that separates the fields of a Netpbm image.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+// readToken skips whitespace and comments, which run from a # to the end of the line, and returns the
+// next field. The whitespace after the field is read too, so a raw image's pixels come straight after it.
+func readToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && len(token) > 0 {
+			return string(token), nil
+		} else if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		} else if err != nil {
+			return "", err
+		}
+
+		switch {
+		case b == '#':
+			if _, err := r.ReadString('\n'); err != nil && err != io.EOF {
+				return "", err
+			}
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		case isSpace(b):
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, b)
+		}
+	}
+}
+
+// readNumber reads a field that should be a number no bigger than max.
+func readNumber(r *bufio.Reader, name string, max int) (int, error) {
+	token, err := readToken(r)
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %v", name, err)
+	}
+	n, err := strconv.Atoi(token)
+	if err != nil || n < 0 || n > max {
+		return 0, fmt.Errorf("%s should be a number from 0 to %d, not %q", name, max, token)
+	}
+	return n, nil
+}
+
+// ReadNetpbmHeader reads the header of a PBM or PGM image, leaving r at the start of the pixels.
+func ReadNetpbmHeader(r *bufio.Reader) (h NetpbmHeader, err error) {
+	if h.Format, err = readToken(r); err != nil {
+		return h, fmt.Errorf("reading format: %v", err)
+	}
+	switch h.Format {
+	case PlainPBM, PlainPGM, RawPBM, RawPGM:
+	default:
+		return h, fmt.Errorf("format %q isn't a PBM or PGM image", h.Format)
+	}
+
+	if h.Width, err = readNumber(r, "width", 1<<20); err != nil {
+		return
+	}
+	if h.Height, err = readNumber(r, "height", 1<<20); err != nil {
+		return
+	}
+	if h.Width == 0 || h.Height == 0 {
+		return h, errors.New("the image is empty")
+	}
+
+	h.Maxval = 1
+	if !h.bitmap() {
+		if h.Maxval, err = readNumber(r, "maxval", 65535); err != nil {
+			return
+		}
+		if h.Maxval == 0 {
+			return h, errors.New("maxval should be at least 1")
+		}
+	}
+	return
+}
+
+// ReadNetpbm reads a PBM or PGM image into a world, streaming it a row at a time. A black pixel in a
+// bitmap is an alive cell. Grey levels are scaled to a maxval of 255, and are left for a Generations rule
+// to take as dying cells, or for Threshold to turn into alive and dead cells.
+func ReadNetpbm(r io.Reader) (World, error) {
+	reader := bufio.NewReader(r)
+	h, err := ReadNetpbmHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	world := MakeWorld(h.Height, h.Width)
+	raw := make([]byte, h.rowBytes())
+	for y, row := range world {
+		if err := h.readRow(reader, row, raw); err != nil {
+			return nil, fmt.Errorf("reading row %d: %v", y, err)
+		}
+	}
+	return world, nil
+}
+
+// rowBytes is the number of bytes a row of a raw image takes up.
+func (h NetpbmHeader) rowBytes() int {
+	switch {
+	case h.plain():
+		return 0
+	case h.bitmap():
+		return (h.Width + 7) / 8
+	case h.Maxval > 255:
+		return 2 * h.Width
+	default:
+		return h.Width
+	}
+}
+
+// readRow reads a row of pixels into cells, using raw as a buffer for a raw image's bytes.
+func (h NetpbmHeader) readRow(r *bufio.Reader, row []byte, raw []byte) error {
+	if !h.plain() {
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return err
+		}
+	}
+
+	for x := range row {
+		var value int
+		switch h.Format {
+		case PlainPBM:
+			// the digits of a plain bitmap don't have to be separated
+			b, err := r.ReadByte()
+			for err == nil && isSpace(b) {
+				b, err = r.ReadByte()
+			}
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			} else if err != nil {
+				return err
+			}
+			if b != '0' && b != '1' {
+				return fmt.Errorf("pixel should be 0 or 1, not %q", b)
+			}
+			value = int(b - '0')
+		case PlainPGM:
+			var err error
+			if value, err = readNumber(r, "pixel", h.Maxval); err != nil {
+				return err
+			}
+		case RawPBM:
+			value = int(raw[x/8]>>uint(7-x%8)) & 1
+		case RawPGM:
+			if h.Maxval > 255 {
+				value = int(raw[2*x])<<8 | int(raw[2*x+1])
+			} else {
+				value = int(raw[x])
+			}
+			if value > h.Maxval {
+				return fmt.Errorf("pixel %d is more than maxval %d", value, h.Maxval)
+			}
+		}
+
+		row[x] = byte((value*int(LiveCell) + h.Maxval/2) / h.Maxval)
+	}
+	return nil
+}
+
+// Threshold makes the cells in a world with grey levels alive if they are more than half way to white, and dead otherwise.
+func Threshold(w World) {
+	for _, row := range w {
+		for x, cell := range row {
+			if cell > LiveCell/2 {
+				row[x] = LiveCell
+			} else {
+				row[x] = DeadCell
+			}
+		}
+	}
+}
+
+// WriteNetpbm writes a world as an image in one of the Netpbm formats. Greymaps have a maxval of 255,
+// so each cell is written as it is, including the grey levels of a Generations rule's dying cells.
+// Bitmaps can only show whether a cell is alive, as a black pixel.
+func WriteNetpbm(w io.Writer, world World, format string) error {
+	h := NetpbmHeader{Format: format, Height: len(world), Maxval: int(LiveCell)}
+	if h.Height > 0 {
+		h.Width = len(world[0])
+	}
+
+	writer := bufio.NewWriter(w)
+	switch format {
+	case PlainPBM, RawPBM:
+		fmt.Fprintf(writer, "%s\n%d %d\n", format, h.Width, h.Height)
+	case PlainPGM, RawPGM:
+		fmt.Fprintf(writer, "%s\n%d %d\n%d\n", format, h.Width, h.Height, h.Maxval)
+	default:
+		return fmt.Errorf("format %q isn't a PBM or PGM image", format)
+	}
+
+	raw := make([]byte, h.rowBytes())
+	for _, row := range world {
+		switch format {
+		case PlainPBM, PlainPGM:
+			// plain images shouldn't have lines longer than 70 characters
+			line := 0
+			for x, cell := range row {
+				field := strconv.Itoa(int(cell))
+				if format == PlainPBM {
+					field = "0"
+					if cell == LiveCell {
+						field = "1"
+					}
+				}
+				if x > 0 && line+1+len(field) > 70 {
+					writer.WriteByte('\n')
+					line = 0
+				} else if x > 0 {
+					writer.WriteByte(' ')
+					line++
+				}
+				writer.WriteString(field)
+				line += len(field)
+			}
+			writer.WriteByte('\n')
+		case RawPBM:
+			for i := range raw {
+				raw[i] = 0
+			}
+			for x, cell := range row {
+				if cell == LiveCell {
+					raw[x/8] |= 0x80 >> uint(x%8)
+				}
+			}
+			writer.Write(raw)
+		case RawPGM:
+			writer.Write(row)
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,158 @@
+package golUtils
+
+import "errors"
+
+// MaxWorldCells is the most cells a packed world can have, so a bad request can't make Unpack try to
+// allocate more memory than there is. It is enough for a 16384x16384 world.
+const MaxWorldCells = 1 << 28
+
+// PackedWorld is a world encoded for sending over RPC. Cells are packed 8 to a byte, row by row,
+// and the packed bytes are then run-length encoded, since most of a board is usually dead.
+// Worlds with cells in the intermediate states of a Generations rule can't be packed into bits,
+// so they are sent a byte per cell with Bits set to 8.
+type PackedWorld struct {
+	Width  int
+	Height int
+	Bits   int
+	Data   []byte
+}
+
+// PackWorld encodes a world, using a bit per cell unless it has cells that are neither alive nor dead.
+func PackWorld(w World) PackedWorld {
+	height := len(w)
+	width := 0
+	if height > 0 {
+		width = len(w[0])
+	}
+
+	for _, row := range w {
+		for _, cell := range row {
+			if cell != LiveCell && cell != DeadCell {
+				return packLevels(w, width, height)
+			}
+		}
+	}
+
+	bits := make([]byte, (width*height+7)/8)
+	i := 0
+	for _, row := range w {
+		for _, cell := range row {
+			if cell == LiveCell {
+				bits[i/8] |= 1 << uint(i%8)
+			}
+			i++
+		}
+	}
+
+	return PackedWorld{Width: width, Height: height, Bits: 1, Data: runLengthEncode(bits)}
+}
+
+func packLevels(w World, width, height int) PackedWorld {
+	levels := make([]byte, 0, width*height)
+	for _, row := range w {
+		levels = append(levels, row...)
+	}
+	return PackedWorld{Width: width, Height: height, Bits: 8, Data: runLengthEncode(levels)}
+}
+
+// Unpack decodes the world, returning an error if the data doesn't match the dimensions,
+// or the dimensions aren't positive or would make a world with more than MaxWorldCells.
+func (pw PackedWorld) Unpack() (World, error) {
+	if pw.Width <= 0 || pw.Height <= 0 || pw.Width > MaxWorldCells/pw.Height {
+		return nil, errors.New("packed world has a bad size")
+	}
+	if pw.Bits == 8 {
+		levels, err := runLengthDecode(pw.Data, pw.Width*pw.Height)
+		if err != nil {
+			return nil, err
+		}
+		w := MakeWorld(pw.Height, pw.Width)
+		for y := range w {
+			copy(w[y], levels[y*pw.Width:(y+1)*pw.Width])
+		}
+		return w, nil
+	}
+
+	bits, err := runLengthDecode(pw.Data, (pw.Width*pw.Height+7)/8)
+	if err != nil {
+		return nil, err
+	}
+
+	w := MakeWorld(pw.Height, pw.Width)
+	i := 0
+	for y := 0; y < pw.Height; y++ {
+		for x := 0; x < pw.Width; x++ {
+			if bits[i/8]&(1<<uint(i%8)) != 0 {
+				w[y][x] = LiveCell
+			}
+			i++
+		}
+	}
+	return w, nil
+}
+
+// runLengthEncode uses the PackBits scheme. Each header byte n is followed by either n+1 literal
+// bytes (0 <= n <= 127) or a single byte to repeat 1-n times (-127 <= n <= -1, as an int8).
+func runLengthEncode(data []byte) []byte {
+	out := make([]byte, 0, len(data)/8+1)
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && run < 128 && data[i+run] == data[i] {
+			run++
+		}
+
+		if run >= 3 {
+			out = append(out, byte(257-run), data[i])
+			i += run
+			continue
+		}
+
+		// copy literals until the next run that is worth encoding
+		start := i
+		for i < len(data) && i-start < 128 {
+			if i+2 < len(data) && data[i] == data[i+1] && data[i] == data[i+2] {
+				break
+			}
+			i++
+		}
+		out = append(out, byte(i-start-1))
+		out = append(out, data[start:i]...)
+	}
+	return out
+}
+
+func runLengthDecode(data []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(data); {
+		header := int(int8(data[i]))
+		i++
+
+		if header >= 0 {
+			n := header + 1
+			if i+n > len(data) {
+				return nil, errors.New("run-length data ends part way through a literal")
+			}
+			if len(out)+n > size {
+				return nil, errors.New("run-length data is longer than the world")
+			}
+			out = append(out, data[i:i+n]...)
+			i += n
+		} else if header != -128 {
+			if i >= len(data) {
+				return nil, errors.New("run-length data ends part way through a run")
+			}
+			if len(out)+1-header > size {
+				return nil, errors.New("run-length data is longer than the world")
+			}
+			for j := 0; j < 1-header; j++ {
+				out = append(out, data[i])
+			}
+			i++
+		}
+	}
+
+	if len(out) != size {
+		return nil, errors.New("run-length data doesn't match the world size")
+	}
+	return out, nil
+}
@@ -0,0 +1,57 @@
+package golUtils
+
+import "testing"
+
+func TestPackWorld(t *testing.T) {
+	w := MakeWorld(3, 20)
+	w[0][1] = LiveCell
+	w[2][19] = LiveCell
+	generations := MakeWorld(2, 2)
+	generations[1][0] = 128
+
+	for _, world := range []World{w, generations} {
+		unpacked, err := PackWorld(world).Unpack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := range world {
+			if string(unpacked[y]) != string(world[y]) {
+				t.Errorf("row %d is %v after packing, expected %v", y, unpacked[y], world[y])
+			}
+		}
+	}
+}
+
+// TestUnpackBadSize checks that worlds that are empty, have negative sizes or are too big to
+// allocate are refused before anything is allocated, as they come from RPC requests.
+func TestUnpackBadSize(t *testing.T) {
+	data := PackWorld(MakeWorld(4, 4)).Data
+	tests := []struct {
+		name          string
+		width, height int
+	}{
+		{"empty", 0, 0},
+		{"no rows", 4, 0},
+		{"negative width", -4, 4},
+		{"negative height", 4, -4},
+		{"both negative", -4, -4},
+		{"too wide", MaxWorldCells + 1, 1},
+		{"too many cells", 1 << 15, 1 << 15},
+		{"overflowing", 1 << 62, 1 << 62},
+	}
+	for _, test := range tests {
+		for _, bits := range []int{1, 8} {
+			pw := PackedWorld{Width: test.width, Height: test.height, Bits: bits, Data: data}
+			if _, err := pw.Unpack(); err == nil {
+				t.Errorf("%s %dx%d with %d bits was unpacked", test.name, test.width, test.height, bits)
+			}
+		}
+	}
+
+	// more data than the world has room for
+	pw := PackWorld(MakeWorld(64, 64))
+	pw.Height = 1
+	if _, err := pw.Unpack(); err == nil {
+		t.Error("data for a 64x64 world was unpacked as 64x1")
+	}
+}
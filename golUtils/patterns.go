@@ -0,0 +1,289 @@
+package golUtils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Pattern is a Life pattern read from an RLE or .cells file, along with the rule in an RLE file's header.
+// The cells of a Generations rule's dying states are stored as their grey levels, as they are in a world.
+type Pattern struct {
+	Cells World
+	Rule  string
+}
+
+// Place copies a pattern into the world with its top left corner at the given cell.
+func Place(w World, pattern World, at CoOrds) error {
+	height := len(pattern)
+	width := 0
+	if height > 0 {
+		width = len(pattern[0])
+	}
+	if at.X < 0 || at.Y < 0 || at.Y+height > len(w) || (height > 0 && at.X+width > len(w[0])) {
+		return fmt.Errorf("a %dx%d pattern at (%d, %d) doesn't fit in the world", width, height, at.X, at.Y)
+	}
+	for y, row := range pattern {
+		copy(w[at.Y+y][at.X:], row)
+	}
+	return nil
+}
+
+// ReadRLE reads a pattern in the run length encoded format used by Golly and LifeWiki. The header
+// gives its size and, optionally, its rule. Multi-state patterns use . for dead cells, A for alive
+// cells and B onwards for the dying states of a Generations rule, which has to be given in the header.
+func ReadRLE(r io.Reader) (p Pattern, err error) {
+	reader := bufio.NewReader(r)
+
+	// comment lines, starting with #, come before the header
+	var header string
+	for {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line != "" && line[0] != '#' {
+			header = line
+			break
+		}
+		if readErr != nil {
+			return p, fmt.Errorf("reading header: %v", io.ErrUnexpectedEOF)
+		}
+	}
+
+	width, height := -1, -1
+	for _, field := range strings.Split(header, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return p, fmt.Errorf("header field %q should be name = value", strings.TrimSpace(field))
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch name {
+		case "x":
+			width, err = strconv.Atoi(value)
+		case "y":
+			height, err = strconv.Atoi(value)
+		case "rule":
+			p.Rule = value
+		}
+		if err != nil || width < -1 || height < -1 {
+			return p, fmt.Errorf("%s should be a number, not %q", name, value)
+		}
+	}
+	if width < 0 || height < 0 {
+		return p, fmt.Errorf("header %q should give x and y", header)
+	}
+
+	// the rule is only needed to find the grey levels of dying states
+	var rule *Rule
+	p.Cells = MakeWorld(height, width)
+	x, y, run := 0, 0, 0
+	for {
+		b, readErr := reader.ReadByte()
+		if readErr == io.EOF {
+			return p, fmt.Errorf("reading cells: %v", io.ErrUnexpectedEOF)
+		} else if readErr != nil {
+			return p, readErr
+		}
+
+		var state byte
+		// states after X, state 24, are two letters: p to y and then A to X
+		prefix := 0
+		if b >= 'p' && b <= 'y' {
+			prefix = int(b-'p') + 1
+			if b, readErr = reader.ReadByte(); readErr != nil || b < 'A' || b > 'X' {
+				return p, fmt.Errorf("state prefix %c should be followed by A to X", 'p'+prefix-1)
+			}
+		}
+		switch {
+		case b >= '0' && b <= '9':
+			run = run*10 + int(b-'0')
+			continue
+		case isSpace(b):
+			continue
+		case b == '!':
+			return p, nil
+		case b == '$':
+			if run == 0 {
+				run = 1
+			}
+			x, y, run = 0, y+run, 0
+			continue
+		case b == 'b' || b == '.':
+			state = DeadCell
+		case (b == 'o' || b == 'A') && prefix == 0:
+			state = LiveCell
+		case b >= 'A' && b <= 'X':
+			if rule == nil {
+				parsed, ruleErr := ParseRule(p.Rule)
+				if ruleErr != nil {
+					return p, ruleErr
+				}
+				rule = &parsed
+			}
+			k := prefix*24 + int(b-'A')
+			if k > rule.States-2 {
+				return p, fmt.Errorf("state %d isn't one of the states of rule %s", k+1, rule)
+			}
+			state = rule.dyingLevel(k)
+		default:
+			return p, fmt.Errorf("unexpected %q in the cells", b)
+		}
+
+		if run == 0 {
+			run = 1
+		}
+		if y >= height || x+run > width {
+			return p, fmt.Errorf("cells go outside the %dx%d pattern given in the header", width, height)
+		}
+		for ; run > 0; run-- {
+			p.Cells[y][x] = state
+			x++
+		}
+	}
+}
+
+// rleWriter writes runs of cells, keeping lines no longer than 70 characters as Golly does.
+type rleWriter struct {
+	writer *bufio.Writer
+	line   int
+}
+
+func (w *rleWriter) run(count int, tag string) {
+	if count == 0 {
+		return
+	}
+	item := tag
+	if count > 1 {
+		item = strconv.Itoa(count) + item
+	}
+	if w.line+len(item) > 70 {
+		w.writer.WriteByte('\n')
+		w.line = 0
+	}
+	w.writer.WriteString(item)
+	w.line += len(item)
+}
+
+// stateTag is the multi-state tag of state n, counting alive cells as state 1. Golly runs out of
+// letters after X, state 24, so the states after that are written p to y followed by A to X.
+func stateTag(n int) string {
+	if n <= 24 {
+		return string('A' + byte(n-1))
+	}
+	return string([]byte{'p' + byte((n-25)/24), 'A' + byte((n-25)%24)})
+}
+
+// WriteRLE writes a world as an RLE pattern, with the rule in its header. A world with the dying cells
+// of a Generations rule is written with multi-state tags.
+func WriteRLE(w io.Writer, world World, rule Rule) error {
+	height := len(world)
+	width := 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	tag := func(cell byte) string {
+		switch {
+		case rule.States > 2 && cell == DeadCell:
+			return "."
+		case rule.States > 2 && cell == LiveCell:
+			return "A"
+		case rule.States > 2:
+			return stateTag(rule.dyingState(cell) + 1)
+		case cell == LiveCell:
+			return "o"
+		default:
+			return "b"
+		}
+	}
+
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "x = %d, y = %d, rule = %s\n", width, height, rule)
+	rle := rleWriter{writer: writer}
+	// runs of empty rows, and the dead cells at the end of a row, are left out
+	emptyRows := 0
+	for y, row := range world {
+		end := len(row)
+		for end > 0 && row[end-1] == DeadCell {
+			end--
+		}
+		if end == 0 {
+			emptyRows++
+			continue
+		}
+		if y > emptyRows {
+			// one $ ends the row written before, and one more skips each empty row
+			emptyRows++
+		}
+		rle.run(emptyRows, "$")
+		emptyRows = 0
+
+		count := 0
+		var last string
+		for _, cell := range row[:end] {
+			if count > 0 && tag(cell) != last {
+				rle.run(count, last)
+				count = 0
+			}
+			last = tag(cell)
+			count++
+		}
+		rle.run(count, last)
+	}
+	rle.run(1, "!")
+	writer.WriteByte('\n')
+	return writer.Flush()
+}
+
+// ReadCells reads a pattern in the plaintext .cells format, where lines starting with ! are comments,
+// O is an alive cell and . is a dead one. Rows can be left short, so the pattern is as wide as its longest row.
+func ReadCells(r io.Reader) (p Pattern, err error) {
+	var rows []string
+	width := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		rows = append(rows, line)
+		if len(line) > width {
+			width = len(line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	p.Cells = MakeWorld(len(rows), width)
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			switch row[x] {
+			case 'O', '*':
+				p.Cells[y][x] = LiveCell
+			case '.':
+			default:
+				return p, fmt.Errorf("unexpected %q on row %d", row[x], y)
+			}
+		}
+	}
+	return
+}
+
+// WriteCells writes a world in the plaintext .cells format, with its name in a comment.
+// The format only has alive and dead cells, so dying cells are written as dead.
+func WriteCells(w io.Writer, world World, name string) error {
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "!Name: %s\n", name)
+	for _, row := range world {
+		for _, cell := range row {
+			if cell == LiveCell {
+				writer.WriteByte('O')
+			} else {
+				writer.WriteByte('.')
+			}
+		}
+		writer.WriteByte('\n')
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,76 @@
+package golUtils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestRLEStates writes a row holding every state of a Generations rule and reads it back. Rules with
+// more than 25 states need the two letter tags that come after X.
+func TestRLEStates(t *testing.T) {
+	tests := []struct {
+		rule string
+		tags []string
+	}{
+		{"B2/S/C3", []string{"A", "B"}},
+		{"B2/S/C25", []string{"X"}},
+		{"B2/S/C26", []string{"X", "pA"}},
+		{"B2/S/C40", []string{"pA", "pO"}},
+		{"B2/S/C255", []string{"pA", "qA", "yN"}},
+	}
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			rule, err := ParseRule(test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// dead, alive, then each dying state with a dead cell between them
+			world := MakeWorld(2, 2*rule.States)
+			world[0][1] = LiveCell
+			for k := 1; k <= rule.States-2; k++ {
+				world[1][2*k+1] = rule.dyingLevel(k)
+			}
+
+			var rle bytes.Buffer
+			if err := WriteRLE(&rle, world, rule); err != nil {
+				t.Fatal(err)
+			}
+			for _, tag := range test.tags {
+				if !strings.Contains(rle.String(), tag) {
+					t.Errorf("%s has no %s tag:\n%s", test.rule, tag, rle.String())
+				}
+			}
+
+			pattern, err := ReadRLE(&rle)
+			if err != nil {
+				t.Fatalf("reading back %s: %v", test.rule, err)
+			}
+			if pattern.Rule != rule.String() {
+				t.Errorf("rule read back as %s, expected %s", pattern.Rule, rule)
+			}
+			for y, row := range world {
+				for x, cell := range row {
+					if pattern.Cells[y][x] != cell {
+						t.Errorf("cell (%d, %d) read back as %d, expected %d", x, y, pattern.Cells[y][x], cell)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestRLEBadStates checks that a state the rule doesn't have, or a prefix without its letter, is an error.
+func TestRLEBadStates(t *testing.T) {
+	tests := []string{
+		"x = 1, y = 1, rule = B2/S/C3\nC!",
+		"x = 1, y = 1, rule = B2/S/C26\npB!",
+		"x = 1, y = 1, rule = B2/S/C40\np!",
+		"x = 1, y = 1, rule = B2/S/C40\npZ!",
+	}
+	for _, test := range tests {
+		if _, err := ReadRLE(strings.NewReader(test)); err == nil {
+			t.Errorf("reading %q should fail", test)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package golUtils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Rule is a life-like or Generations rule. Bit n of Birth is set if a dead cell with n alive
+// neighbours is born, and bit n of Survival is set if an alive cell with n alive neighbours stays alive.
+//
+// States is the number of states a cell can be in for a Generations rule. An alive cell that doesn't
+// survive passes through States-2 dying states, stored as decreasing grey levels, before it is dead.
+// Dying cells don't count as alive neighbours and can't be born. States is 0 or 2 for a life-like rule.
+type Rule struct {
+	Birth    uint16
+	Survival uint16
+	States   int
+}
+
+// Conway is the rule of the standard Game of Life.
+var Conway = Rule{Birth: 1 << 3, Survival: 1<<2 | 1<<3}
+
+// namedRules lets well known rules be given by name instead of in B/S notation.
+var namedRules = map[string]string{
+	"life":             "B3/S23",
+	"highlife":         "B36/S23",
+	"seeds":            "B2/S",
+	"daynight":         "B3678/S34678",
+	"lifewithoutdeath": "B3/S012345678",
+	"diamoeba":         "B35678/S5678",
+	"2x2":              "B36/S125",
+	"morley":           "B368/S245",
+	"replicator":       "B1357/S1357",
+	"briansbrain":      "B2/S/C3",
+	"starwars":         "B2/S345/C4",
+	"frogs":            "B34/S12/C3",
+}
+
+// ParseRule reads a rule in B/S notation, e.g. "B36/S23" for HighLife, or one of the named rules.
+// Generations rules add the number of states, e.g. "B2/S/C3" or "B2/S/3" for Brian's Brain.
+// The older S/B notation found in some RLE patterns, e.g. "23/3" or "/2/3", is read too.
+// An empty string gives Conway's rule.
+func ParseRule(s string) (Rule, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return Conway, nil
+	}
+	if named, ok := namedRules[strings.NewReplacer(" ", "", "&", "", "-", "").Replace(s)]; ok {
+		s = strings.ToLower(named)
+	}
+
+	parts := strings.Split(s, "/")
+	var r Rule
+	if len(parts) == 3 {
+		states, err := strconv.Atoi(strings.TrimPrefix(parts[2], "c"))
+		if err != nil || states < 2 || states > 255 {
+			return Rule{}, errors.New("number of states in a Generations rule must be between 2 and 255")
+		}
+		r.States = states
+		parts = parts[:2]
+	}
+	if len(parts) != 2 {
+		return Rule{}, errors.New("rule should be in B/S notation, e.g. B3/S23")
+	}
+	if strings.Trim(parts[0]+parts[1], "012345678") == "" {
+		parts = []string{"b" + parts[1], "s" + parts[0]}
+	}
+
+	seen := map[byte]bool{}
+	for _, part := range parts {
+		if part == "" || (part[0] != 'b' && part[0] != 's') || seen[part[0]] {
+			return Rule{}, errors.New("rule should be in B/S notation, e.g. B3/S23")
+		}
+		seen[part[0]] = true
+
+		var counts uint16
+		for _, digit := range part[1:] {
+			if digit < '0' || digit > '8' {
+				return Rule{}, errors.New("neighbour counts in a rule must be between 0 and 8")
+			}
+			counts |= 1 << uint(digit-'0')
+		}
+		if part[0] == 'b' {
+			r.Birth = counts
+		} else {
+			r.Survival = counts
+		}
+	}
+	return r, nil
+}
+
+// String gives the rule in B/S notation.
+func (r Rule) String() string {
+	s := "B"
+	for n := 0; n <= 8; n++ {
+		if r.Birth&(1<<uint(n)) != 0 {
+			s += strconv.Itoa(n)
+		}
+	}
+	s += "/S"
+	for n := 0; n <= 8; n++ {
+		if r.Survival&(1<<uint(n)) != 0 {
+			s += strconv.Itoa(n)
+		}
+	}
+	if r.States > 2 {
+		s += "/C" + strconv.Itoa(r.States)
+	}
+	return s
+}
+
+// dyingLevel is the grey level of the k-th dying state, for 1 <= k <= States-2.
+func (r Rule) dyingLevel(k int) byte {
+	return byte(255 - k*255/(r.States-1))
+}
+
+// dyingState inverts dyingLevel. Other grey levels are rounded to the next state down,
+// so images with any grey levels can be loaded.
+func (r Rule) dyingState(level byte) int {
+	k := ((255-int(level))*(r.States-1) + 254) / 255
+	if k < 1 {
+		k = 1
+	}
+	if k > r.States-2 {
+		k = r.States - 2
+	}
+	return k
+}
+
+// NextCell gives the state of a cell next turn, given its state now and how many of its
+// neighbours are alive.
+func (r Rule) NextCell(cell byte, aliveNeighbours int) byte {
+	switch {
+	case cell == LiveCell:
+		if r.Survival&(1<<uint(aliveNeighbours)) != 0 {
+			return LiveCell
+		}
+		if r.States > 2 {
+			return r.dyingLevel(1)
+		}
+		return DeadCell
+	case cell == DeadCell || r.States <= 2:
+		if r.Birth&(1<<uint(aliveNeighbours)) != 0 {
+			return LiveCell
+		}
+		return DeadCell
+	default:
+		if k := r.dyingState(cell) + 1; k < r.States-1 {
+			return r.dyingLevel(k)
+		}
+		return DeadCell
+	}
+}
@@ -0,0 +1,144 @@
+package golUtils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	highLife := Rule{Birth: 1<<3 | 1<<6, Survival: 1<<2 | 1<<3}
+	tests := []struct {
+		rule     string
+		expected Rule
+	}{
+		{"", Conway},
+		{"B3/S23", Conway},
+		{"b3/s23", Conway},
+		{" B3/S23 ", Conway},
+		{"S23/B3", Conway},
+		{"23/3", Conway},
+		{"Life", Conway},
+		{"B36/S23", highLife},
+		{"HighLife", highLife},
+		{"high life", highLife},
+		{"Day & Night", Rule{Birth: 1<<3 | 1<<6 | 1<<7 | 1<<8, Survival: 1<<3 | 1<<4 | 1<<6 | 1<<7 | 1<<8}},
+		{"seeds", Rule{Birth: 1 << 2}},
+		{"B2/S", Rule{Birth: 1 << 2}},
+		{"B/S012345678", Rule{Survival: 0x1ff}},
+		{"B0/S8", Rule{Birth: 1, Survival: 1 << 8}},
+		{"B2/S/C3", Rule{Birth: 1 << 2, States: 3}},
+		{"B2/S/3", Rule{Birth: 1 << 2, States: 3}},
+		{"/2/3", Rule{Birth: 1 << 2, States: 3}},
+		{"Brians Brain", Rule{Birth: 1 << 2, States: 3}},
+		{"Star Wars", Rule{Birth: 1 << 2, Survival: 1<<3 | 1<<4 | 1<<5, States: 4}},
+		{"B3/S23/C2", Rule{Birth: 1 << 3, Survival: 1<<2 | 1<<3, States: 2}},
+		{"B2/S/C255", Rule{Birth: 1 << 2, States: 255}},
+	}
+	for _, test := range tests {
+		rule, err := ParseRule(test.rule)
+		if err != nil {
+			t.Errorf("ParseRule(%q) failed: %v", test.rule, err)
+		} else if rule != test.expected {
+			t.Errorf("ParseRule(%q) = %s, expected %s", test.rule, rule, test.expected)
+		}
+	}
+
+	for _, bad := range []string{"B3", "B3/S23/", "B9/S23", "B3/S2a", "X3/S23", "B3/B23", "S23/S3", "B3/S23/C/1", "bad",
+		"B2/S/C0", "B2/S/C1", "B2/S/C256", "B2/S/Cx"} {
+		if rule, err := ParseRule(bad); err == nil {
+			t.Errorf("ParseRule(%q) = %s, expected an error", bad, rule)
+		}
+	}
+}
+
+// TestRuleString checks that every named rule comes back the same after being written in B/S notation.
+func TestRuleString(t *testing.T) {
+	for name := range namedRules {
+		rule, err := ParseRule(name)
+		if err != nil {
+			t.Fatalf("ParseRule(%q) failed: %v", name, err)
+		}
+		again, err := ParseRule(rule.String())
+		if err != nil || again != rule {
+			t.Errorf("%s is written as %s, which reads back as %s (%v)", name, rule, again, err)
+		}
+	}
+}
+
+func TestNextCell(t *testing.T) {
+	highLife, _ := ParseRule("highlife")
+	brain, _ := ParseRule("briansbrain")
+	starWars, _ := ParseRule("starwars")
+	tests := []struct {
+		rule       Rule
+		cell       byte
+		neighbours int
+		expected   byte
+	}{
+		{Conway, LiveCell, 0, DeadCell},
+		{Conway, LiveCell, 1, DeadCell},
+		{Conway, LiveCell, 2, LiveCell},
+		{Conway, LiveCell, 3, LiveCell},
+		{Conway, LiveCell, 4, DeadCell},
+		{Conway, LiveCell, 8, DeadCell},
+		{Conway, DeadCell, 2, DeadCell},
+		{Conway, DeadCell, 3, LiveCell},
+		{Conway, DeadCell, 6, DeadCell},
+		{highLife, DeadCell, 6, LiveCell},
+		{highLife, LiveCell, 6, DeadCell},
+		{Rule{Birth: 1}, DeadCell, 0, LiveCell},
+
+		// Brian's Brain: every alive cell dies, through one dying state at half grey
+		{brain, LiveCell, 2, 128},
+		{brain, LiveCell, 3, 128},
+		{brain, 128, 2, DeadCell},
+		{brain, DeadCell, 2, LiveCell},
+		// Star Wars: cells fade through 170 and 85, and dying cells can't be born or survive
+		{starWars, LiveCell, 3, LiveCell},
+		{starWars, LiveCell, 2, 170},
+		{starWars, 170, 3, 85},
+		{starWars, 85, 2, DeadCell},
+		{starWars, DeadCell, 2, LiveCell},
+		// other grey levels are taken as the next dying state down
+		{starWars, 200, 0, 85},
+		{starWars, 1, 0, DeadCell},
+	}
+	for _, test := range tests {
+		if next := test.rule.NextCell(test.cell, test.neighbours); next != test.expected {
+			t.Errorf("%s: cell %d with %d alive neighbours became %d, expected %d",
+				test.rule, test.cell, test.neighbours, next, test.expected)
+		}
+	}
+}
+
+// TestHighLifeReplicator runs HighLife's replicator, which after 12 turns has made two copies of
+// itself, two cells up and left and two cells down and right of where it was. Life's rule would not.
+func TestHighLifeReplicator(t *testing.T) {
+	replicator, err := ReadRLE(strings.NewReader("x = 5, y = 5, rule = B36/S23\n2b3o$bo2bo$o3bo$o2bo$3o!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := ParseRule(replicator.Rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Params{ImageWidth: 32, ImageHeight: 32, Rule: rule, Boundary: DeadEdges}
+
+	world := MakeWorld(32, 32)
+	Place(world, replicator.Cells, CoOrds{X: 14, Y: 14})
+	origin := CoOrds{}
+	for turn := 0; turn < 12; turn++ {
+		world, origin = NextWorld(p, world, origin)
+	}
+
+	expected := MakeWorld(32, 32)
+	Place(expected, replicator.Cells, CoOrds{X: 12, Y: 12})
+	Place(expected, replicator.Cells, CoOrds{X: 16, Y: 16})
+	for y, row := range expected {
+		for x, cell := range row {
+			if world[y][x] != cell {
+				t.Fatalf("cell (%d, %d) is %d after 12 turns, expected %d", x, y, world[y][x], cell)
+			}
+		}
+	}
+}
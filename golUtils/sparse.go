@@ -0,0 +1,132 @@
+package golUtils
+
+// sparseEngine only stores the cells that aren't dead, and only visits the neighbourhoods of alive cells,
+// so it is much faster than the dense engine on a mostly empty world. On the infinite plane it has no
+// bounds at all, so patterns can grow as far beyond the image as they like.
+type sparseEngine struct {
+	params Params
+
+	// Every cell that isn't dead, by its position relative to the image's top left corner
+	cells map[CoOrds]byte
+	alive int
+
+	// ghosts gives, for each cell on the edge of a bounded world, the positions just beyond the
+	// edges that stand for it, so its neighbours across the edge can be found
+	ghosts map[CoOrds][]CoOrds
+}
+
+func newSparseEngine(p Params, w World, origin CoOrds) *sparseEngine {
+	e := &sparseEngine{params: p, cells: make(map[CoOrds]byte)}
+	for y, row := range w {
+		for x, cell := range row {
+			if cell != DeadCell {
+				e.cells[CoOrds{X: x - origin.X, Y: y - origin.Y}] = cell
+			}
+			if cell == LiveCell {
+				e.alive++
+			}
+		}
+	}
+
+	if p.Boundary == Torus || p.Boundary == Reflect || p.Boundary == KleinBottle {
+		e.ghosts = make(map[CoOrds][]CoOrds)
+		var ring []CoOrds
+		for x := -1; x <= p.ImageWidth; x++ {
+			ring = append(ring, CoOrds{X: x, Y: -1}, CoOrds{X: x, Y: p.ImageHeight})
+		}
+		for y := 0; y < p.ImageHeight; y++ {
+			ring = append(ring, CoOrds{X: -1, Y: y}, CoOrds{X: p.ImageWidth, Y: y})
+		}
+		for _, ghost := range ring {
+			x, y, _ := p.Boundary.locate(p.ImageWidth, p.ImageHeight, ghost.X, ghost.Y)
+			cell := CoOrds{X: x, Y: y}
+			e.ghosts[cell] = append(e.ghosts[cell], ghost)
+		}
+	}
+	return e
+}
+
+func (e *sparseEngine) inBounds(c CoOrds) bool {
+	return e.params.Boundary == Infinite || (c.X >= 0 && c.X < e.params.ImageWidth && c.Y >= 0 && c.Y < e.params.ImageHeight)
+}
+
+// spread adds one to the neighbour count of every cell around c.
+func (e *sparseEngine) spread(counts map[CoOrds]int, c CoOrds) {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			neighbour := CoOrds{X: c.X + dx, Y: c.Y + dy}
+			if (dx != 0 || dy != 0) && e.inBounds(neighbour) {
+				counts[neighbour]++
+			}
+		}
+	}
+}
+
+func (e *sparseEngine) Step(turns int) int {
+	counts := make(map[CoOrds]int, len(e.cells)*4)
+	for c, cell := range e.cells {
+		if cell != LiveCell {
+			continue
+		}
+		e.spread(counts, c)
+		for _, ghost := range e.ghosts[c] {
+			e.spread(counts, ghost)
+		}
+	}
+
+	next := make(map[CoOrds]byte, len(e.cells))
+	alive := 0
+	for c, aliveNeighbours := range counts {
+		if cell := e.params.Rule.NextCell(e.cells[c], aliveNeighbours); cell != DeadCell {
+			next[c] = cell
+			if cell == LiveCell {
+				alive++
+			}
+		}
+	}
+	// cells with no alive neighbours can still be alive or dying
+	for c, cell := range e.cells {
+		if _, counted := counts[c]; counted {
+			continue
+		}
+		if cell = e.params.Rule.NextCell(cell, 0); cell != DeadCell {
+			next[c] = cell
+			if cell == LiveCell {
+				alive++
+			}
+		}
+	}
+	e.cells = next
+	e.alive = alive
+	return 1
+}
+
+// World makes a dense world big enough to hold the image and every cell that isn't dead.
+func (e *sparseEngine) World() (World, CoOrds) {
+	minX, minY := 0, 0
+	maxX, maxY := e.params.ImageWidth-1, e.params.ImageHeight-1
+	for c := range e.cells {
+		if c.X < minX {
+			minX = c.X
+		}
+		if c.Y < minY {
+			minY = c.Y
+		}
+		if c.X > maxX {
+			maxX = c.X
+		}
+		if c.Y > maxY {
+			maxY = c.Y
+		}
+	}
+
+	w := MakeWorld(maxY-minY+1, maxX-minX+1)
+	for c, cell := range e.cells {
+		w[c.Y-minY][c.X-minX] = cell
+	}
+	return w, CoOrds{X: -minX, Y: -minY}
+}
+
+func (e *sparseEngine) AliveCells() int {
+	return e.alive
+}
@@ -3,11 +3,15 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"net/rpc"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 
+	"uk.ac.bris.cs/gameoflife/engine"
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/golUtils"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
@@ -46,6 +50,157 @@ func TestGol(t *testing.T) {
 	}
 }
 
+// runGol runs the Game of Life and returns the cells that are alive when it finishes.
+func runGol(p gol.Params, keyPresses <-chan rune) []util.Cell {
+	events := make(chan gol.Event)
+	go gol.Run(p, events, keyPresses)
+	return finalCells(events)
+}
+
+// finalCells reads the rest of the events and returns the cells that are alive at the end.
+func finalCells(events <-chan gol.Event) []util.Cell {
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	return cells
+}
+
+// awaitState reads events until the state changes to state, failing if the events end first.
+func awaitState(t *testing.T, events <-chan gol.Event, state gol.State) gol.StateChange {
+	for event := range events {
+		if e, ok := event.(gol.StateChange); ok && e.NewState == state {
+			return e
+		}
+	}
+	t.Fatalf("the events ended without a StateChange to %v", state)
+	return gol.StateChange{}
+}
+
+// testImages runs p on the 16x16 and 64x64 images for 1 and 100 turns, and checks the results against the
+// images in check/images/<dir>. TestGol covers every size and thread count, so the variations only need a couple.
+func testImages(t *testing.T, name, dir string, p gol.Params) {
+	for _, size := range []int{16, 64} {
+		p.ImageWidth = size
+		p.ImageHeight = size
+		for _, turns := range []int{1, 100} {
+			p.Turns = turns
+			expectedAlive := readAliveCells(
+				filepath.Join("check/images", dir, fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns)),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			testName := fmt.Sprintf("%s-%dx%dx%d-%d", name, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			t.Run(testName, func(t *testing.T) {
+				assertEqualBoard(t, runGol(p, nil), expectedAlive, p)
+			})
+		}
+	}
+}
+
+// TestBoundaries tests each of the boundaries that aren't a torus, checking against the images in
+// check/images/<boundary>, which are made by check/boundaries.py.
+func TestBoundaries(t *testing.T) {
+	for _, boundary := range []string{"dead", "reflect", "klein", "infinite"} {
+		testImages(t, boundary, boundary, gol.Params{Boundary: boundary, Threads: 4})
+	}
+}
+
+// TestEngines tests every engine on the torus and on each of the boundaries TestBoundaries tests, as they
+// must all give the same results. The combinations an engine can't run must be refused for the reason
+// CheckEngine gives, without being run.
+func TestEngines(t *testing.T) {
+	unsupported := map[[2]string]string{
+		{"hashlife", "dead"}: "the hashlife engine doesn't support dead edges",
+	}
+	for _, engine := range golUtils.EngineNames {
+		for _, boundary := range []string{"", "dead", "reflect", "klein", "infinite"} {
+			name := engine
+			if boundary != "" {
+				name += "-" + boundary
+			}
+			parsed, err := golUtils.ParseBoundary(boundary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the images testImages uses are all 64x64 or smaller powers of two, which every engine can run
+			err = golUtils.CheckEngine(golUtils.Params{ImageWidth: 64, ImageHeight: 64, Rule: golUtils.Conway, Boundary: parsed, Engine: engine})
+			expected, refused := unsupported[[2]string{engine, boundary}]
+			p := gol.Params{Engine: engine, Boundary: boundary, Threads: 4}
+			switch {
+			case err == nil && !refused:
+				testImages(t, name, boundary, p)
+			case err == nil:
+				t.Errorf("%s was accepted, expected it to be refused with %q", name, expected)
+			case !refused:
+				t.Errorf("%s was refused with %q, expected it to be accepted", name, err)
+			case err.Error() != expected:
+				t.Errorf("%s was refused with %q, expected %q", name, err, expected)
+			default:
+				p.ImageWidth, p.ImageHeight, p.Turns = 64, 64, 1
+				t.Run(name+"-refused", func(t *testing.T) {
+					if cells := runGol(p, nil); cells != nil {
+						t.Error("the calculation was run")
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestBackends runs the same tests in-process and over RPC, against an engine.Server in the test process.
+func TestBackends(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("GOLWorker", engine.NewServer(engine.LocalBackend, func() {})); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := engine.Listen(server, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Kill()
+
+	testImages(t, "in-process", "", gol.Params{Threads: 4})
+	testImages(t, "rpc", "", gol.Params{Server: listener.Addr().String(), Threads: 4})
+}
+
+// TestStateChanges pauses, resumes and quits an in-process calculation, and checks that the GUI is told each
+// state in order, with the turn it was paused at agreeing with the turn it resumed from.
+func TestStateChanges(t *testing.T) {
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 1)
+	go gol.Run(gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 10000000, Threads: 4}, events, keyPresses)
+
+	var states []gol.State
+	var turns []int
+	for event := range events {
+		e, ok := event.(gol.StateChange)
+		if !ok {
+			continue
+		}
+		states = append(states, e.NewState)
+		turns = append(turns, e.CompletedTurns)
+		// each key is pressed once the last has taken effect
+		switch len(states) {
+		case 1, 2:
+			keyPresses <- 'p'
+		case 3:
+			keyPresses <- 'q'
+		}
+	}
+
+	expected := []gol.State{gol.Executing, gol.Paused, gol.Executing, gol.Quitting}
+	if fmt.Sprint(states) != fmt.Sprint(expected) {
+		t.Fatalf("states were %v, expected %v", states, expected)
+	}
+	if turns[1] != turns[2] {
+		t.Errorf("paused at turn %d but resumed at turn %d", turns[1], turns[2])
+	}
+}
+
 func boardFail(t *testing.T, given, expected []util.Cell, p gol.Params) bool {
 	errorString := fmt.Sprintf("-----------------\n\n  FAILED TEST\n  %vx%v\n  %d Workers\n  %d Turns\n", p.ImageWidth, p.ImageHeight, p.Threads, p.Turns)
 	if p.ImageWidth == 16 && p.ImageHeight == 16 {
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
 
 	"uk.ac.bris.cs/gameoflife/gol"
@@ -38,6 +39,78 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	flag.StringVar(
+		&params.Input,
+		"input",
+		"",
+		"Specify a PBM or PGM image to load instead of images/WxH.pgm, whose width and height are used in place of -w and -h, or an RLE or .cells pattern to place in a world of size -w by -h.")
+
+	flag.StringVar(
+		&params.Offset,
+		"offset",
+		"",
+		"Specify where the top left corner of an RLE or .cells pattern goes, as x,y. Defaults to the middle of the world.")
+
+	flag.StringVar(
+		&params.Rule,
+		"rule",
+		"B3/S23",
+		"Specify the rule in B/S notation, e.g. B36/S23 for HighLife, or by name (highlife, seeds, daynight, ...). Defaults to the rule in an RLE pattern's header, or B3/S23.")
+
+	flag.StringVar(
+		&params.Boundary,
+		"boundary",
+		"torus",
+		"Specify what lies beyond the edges of the world: torus, dead, reflect, klein or infinite. Defaults to torus.")
+
+	flag.StringVar(
+		&params.Engine,
+		"engine",
+		"dense",
+		"Specify the engine that calculates the turns: dense, sparse, hashlife, which jumps ahead many turns at once, or bitboard, which packs 64 cells into a word. The broker only supports dense. Defaults to dense.")
+
+	flag.StringVar(
+		&params.OutDir,
+		"out",
+		"out",
+		"Specify the directory images are saved to. Defaults to out.")
+
+	flag.StringVar(
+		&params.OutName,
+		"name",
+		"{size}x{turn}",
+		"Specify how images are named, filling in {size}, {width}, {height}, {turn}, {rule} and {timestamp}. Defaults to {size}x{turn}.")
+
+	flag.StringVar(
+		&params.Format,
+		"format",
+		"pgm",
+		"Specify the format images are saved in: pgm, pbm, png, rle or cells. Defaults to pgm.")
+
+	flag.IntVar(
+		&params.GifEvery,
+		"gif",
+		0,
+		"Record every Nth turn as a frame of an animated GIF, saved in the output directory when the run ends. Defaults to 0, which records nothing.")
+
+	flag.StringVar(
+		&params.Server,
+		"server",
+		"127.0.0.1:8030",
+		"Specify the address (ip:port) of the GOL worker or broker, or leave it empty to run in-process. Defaults to 127.0.0.1:8030.")
+
+	flag.BoolVar(
+		&params.Attach,
+		"attach",
+		false,
+		"Attach to the calculation already running on the server instead of starting a new one.")
+
+	flag.IntVar(
+		&params.Session,
+		"session",
+		1,
+		"Specify the session to attach to, as printed when the calculation was started. Defaults to 1.")
+
 	noVis := flag.Bool(
 		"noVis",
 		false,
@@ -45,9 +118,40 @@ func main() {
 
 	flag.Parse()
 
+	ruleSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "rule" {
+			ruleSet = true
+		}
+	})
+
+	// the size has to be known before the window is opened and the world is sent to the server
+	if gol.IsPattern(params.Input) {
+		rule, err := gol.ReadPatternRule(params.Input)
+		if err != nil {
+			fmt.Println("Couldn't read input pattern:", err)
+			os.Exit(1)
+		}
+		if rule != "" && !ruleSet {
+			params.Rule = rule
+		}
+	} else if params.Input != "" {
+		width, height, err := gol.ReadImageSize(params.Input)
+		if err != nil {
+			fmt.Println("Couldn't read input image:", err)
+			os.Exit(1)
+		}
+		params.ImageWidth = width
+		params.ImageHeight = height
+	}
+
 	fmt.Println("Threads:", params.Threads)
 	fmt.Println("Width:", params.ImageWidth)
 	fmt.Println("Height:", params.ImageHeight)
+	fmt.Println("Rule:", params.Rule)
+	fmt.Println("Boundary:", params.Boundary)
+	fmt.Println("Engine:", params.Engine)
+	fmt.Println("Server:", params.Server)
 
 	keyPresses := make(chan rune, 10)
 	events := make(chan gol.Event, 1000)
@@ -58,7 +162,11 @@ func main() {
 	} else {
 		complete := false
 		for !complete {
-			event := <-events
+			event, ok := <-events
+			if !ok {
+				// gol quit without finishing, e.g. because the input couldn't be read
+				break
+			}
 			switch event.(type) {
 			case gol.FinalTurnComplete:
 				complete = true
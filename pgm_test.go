@@ -1,9 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/golUtils"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 // Pgm tests 16x16, 64x64 and 512x512 image output files on 0, 1 and 100 turns using 1-16 worker threads.
@@ -40,3 +52,223 @@ func TestPgm(t *testing.T) {
 		}
 	}
 }
+
+// TestNetpbm tests loading a 64x64 image saved in every Netpbm format, with comments, other maxvals
+// and grey levels, and even pixel bytes that look like whitespace, for 100 turns.
+func TestNetpbm(t *testing.T) {
+	file, err := os.Open("images/64x64.pgm")
+	util.Check(err)
+	world, err := golUtils.ReadNetpbm(file)
+	file.Close()
+	util.Check(err)
+
+	dir, err := ioutil.TempDir("", "netpbm")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+
+	// greyLevels writes a raw or plain greymap by hand, with the given levels for dead and alive cells
+	greyLevels := func(header string, dead, alive int, plain bool) []byte {
+		var b bytes.Buffer
+		b.WriteString(header)
+		for _, row := range world {
+			for _, cell := range row {
+				level := dead
+				if cell == golUtils.LiveCell {
+					level = alive
+				}
+				switch {
+				case plain:
+					fmt.Fprintf(&b, "%d\n", level)
+				case alive > 255:
+					b.Write([]byte{byte(level >> 8), byte(level)})
+				default:
+					b.WriteByte(byte(level))
+				}
+			}
+		}
+		return b.Bytes()
+	}
+
+	images := map[string][]byte{
+		"comments.pgm": greyLevels("P2\n# made by hand\n64 # width\n64\n# maxval next\n1000\n", 100, 900, true),
+		"16-bit.pgm":   greyLevels("P5 64 64 65535\n", 0, 65535, false),
+		"spaces.pgm":   greyLevels("P5\n64 64\n255\n", ' ', 200, false),
+	}
+	for _, format := range []string{golUtils.PlainPBM, golUtils.PlainPGM, golUtils.RawPBM, golUtils.RawPGM} {
+		var b bytes.Buffer
+		util.Check(golUtils.WriteNetpbm(&b, world, format))
+		images[format+".pnm"] = b.Bytes()
+	}
+
+	expectedAlive := readAliveCells("check/images/64x64x100.pgm", 64, 64)
+	for name, image := range images {
+		path := filepath.Join(dir, name)
+		util.Check(ioutil.WriteFile(path, image, 0644))
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4, Input: path, OutDir: dir}
+		t.Run(name, func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var cells []util.Cell
+			for event := range events {
+				switch e := event.(type) {
+				case gol.FinalTurnComplete:
+					cells = e.Alive
+				}
+			}
+			assertEqualBoard(t, cells, expectedAlive, p)
+		})
+	}
+}
+
+// TestPatterns tests loading a 64x64 image saved as an RLE and a .cells pattern, both as a whole and cropped
+// to its alive cells and placed back at an offset, for 100 turns. The final image is saved in the same format.
+func TestPatterns(t *testing.T) {
+	file, err := os.Open("images/64x64.pgm")
+	util.Check(err)
+	world, err := golUtils.ReadNetpbm(file)
+	file.Close()
+	util.Check(err)
+
+	dir, err := ioutil.TempDir("", "patterns")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+
+	// the smallest pattern holding all the alive cells, which is placed back where it came from
+	top, left, bottom, right := 64, 64, 0, 0
+	for y, row := range world {
+		for x, cell := range row {
+			if cell == golUtils.LiveCell {
+				if y < top {
+					top = y
+				}
+				if x < left {
+					left = x
+				}
+				if y >= bottom {
+					bottom = y + 1
+				}
+				if x >= right {
+					right = x + 1
+				}
+			}
+		}
+	}
+	cropped := golUtils.MakeWorld(bottom-top, right-left)
+	for y := range cropped {
+		copy(cropped[y], world[top+y][left:right])
+	}
+	offset := fmt.Sprintf("%d,%d", left, top)
+
+	var rle, croppedRLE, cells, croppedCells bytes.Buffer
+	util.Check(golUtils.WriteRLE(&rle, world, golUtils.Conway))
+	croppedRLE.WriteString("#N 64x64\n#C made by hand\n")
+	util.Check(golUtils.WriteRLE(&croppedRLE, cropped, golUtils.Conway))
+	util.Check(golUtils.WriteCells(&cells, world, "64x64"))
+	util.Check(golUtils.WriteCells(&croppedCells, cropped, "64x64"))
+
+	patterns := []struct {
+		name    string
+		pattern []byte
+		offset  string
+	}{
+		{"whole.rle", rle.Bytes(), ""},
+		{"cropped.rle", croppedRLE.Bytes(), offset},
+		{"whole.cells", cells.Bytes(), "0,0"},
+		{"cropped.cells", croppedCells.Bytes(), offset},
+	}
+
+	expectedAlive := readAliveCells("check/images/64x64x100.pgm", 64, 64)
+	for _, test := range patterns {
+		path := filepath.Join(dir, test.name)
+		util.Check(ioutil.WriteFile(path, test.pattern, 0644))
+		format := strings.TrimPrefix(filepath.Ext(path), ".")
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4, Input: path, Offset: test.offset, OutDir: dir, OutName: test.name + "-{turn}", Format: format}
+		t.Run(test.name, func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var cells []util.Cell
+			var saved string
+			for event := range events {
+				switch e := event.(type) {
+				case gol.ImageOutputComplete:
+					saved = e.Filename
+				case gol.FinalTurnComplete:
+					cells = e.Alive
+				}
+			}
+			if !assertEqualBoard(t, cells, expectedAlive, p) {
+				return
+			}
+
+			file, err := os.Open(saved)
+			util.Check(err)
+			defer file.Close()
+			var pattern golUtils.Pattern
+			if format == "rle" {
+				pattern, err = golUtils.ReadRLE(file)
+			} else {
+				pattern, err = golUtils.ReadCells(file)
+			}
+			util.Check(err)
+			var savedAlive []util.Cell
+			for y, row := range pattern.Cells {
+				for x, cell := range row {
+					if cell == golUtils.LiveCell {
+						savedAlive = append(savedAlive, util.Cell{X: x, Y: y})
+					}
+				}
+			}
+			assertEqualBoard(t, savedAlive, expectedAlive, p)
+		})
+	}
+}
+
+// TestAnimation tests recording every 10th turn of a 64x64 image into an animated GIF over 100 turns, checking
+// the first and last frames, along with the final image saved as a PNG.
+func TestAnimation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "animation")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4, OutDir: dir, Format: "png", GifEvery: 10}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	saved := map[string]string{}
+	for event := range events {
+		switch e := event.(type) {
+		case gol.ImageOutputComplete:
+			saved[filepath.Ext(e.Filename)] = e.Filename
+		}
+	}
+
+	// aliveCells finds the cells in an image that are white
+	aliveCells := func(img image.Image) []util.Cell {
+		var cells []util.Cell
+		for y := 0; y < p.ImageHeight; y++ {
+			for x := 0; x < p.ImageWidth; x++ {
+				if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y == golUtils.LiveCell {
+					cells = append(cells, util.Cell{X: x, Y: y})
+				}
+			}
+		}
+		return cells
+	}
+
+	file, err := os.Open(saved[".gif"])
+	util.Check(err)
+	animation, err := gif.DecodeAll(file)
+	file.Close()
+	util.Check(err)
+	if len(animation.Image) != 11 {
+		t.Fatalf("Expected 11 frames, got %d", len(animation.Image))
+	}
+	assertEqualBoard(t, aliveCells(animation.Image[0]), readAliveCells("check/images/64x64x0.pgm", 64, 64), p)
+	assertEqualBoard(t, aliveCells(animation.Image[10]), readAliveCells("check/images/64x64x100.pgm", 64, 64), p)
+
+	file, err = os.Open(saved[".png"])
+	util.Check(err)
+	final, err := png.Decode(file)
+	file.Close()
+	util.Check(err)
+	assertEqualBoard(t, aliveCells(final), readAliveCells("check/images/64x64x100.pgm", 64, 64), p)
+}
@@ -36,6 +36,8 @@ sdlLoop:
 			switch e := event.(type) {
 			case gol.CellFlipped:
 				w.FlipPixel(e.Cell.X, e.Cell.Y)
+			case gol.CellShaded:
+				w.ShadePixel(e.Cell.X, e.Cell.Y, e.Level)
 			case gol.TurnComplete:
 				w.RenderFrame()
 			case gol.FinalTurnComplete:
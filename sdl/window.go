@@ -87,10 +87,29 @@ func (w *Window) FlipPixel(x, y int) {
 	w.pixels[4*(y*width+x)+3] = ^w.pixels[4*(y*width+x)+3]
 }
 
+// ShadePixel sets a pixel to a grey level, for the dying states of a Generations rule.
+// Level 0 is a dead cell, which is left transparent as a cleared pixel is, so that flipping it gives an opaque white pixel.
+func (w *Window) ShadePixel(x, y int, level uint8) {
+	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
+		panic(fmt.Sprintf("CellShaded event at (%d, %d) is outside the bounds of the window.", x, y))
+	}
+
+	alpha := uint8(0xFF)
+	if level == 0 {
+		alpha = 0
+	}
+	width := int(w.Width)
+	w.pixels[4*(y*width+x)+0] = level
+	w.pixels[4*(y*width+x)+1] = level
+	w.pixels[4*(y*width+x)+2] = level
+	w.pixels[4*(y*width+x)+3] = alpha
+}
+
+// CountPixels counts the opaque white pixels, which are the alive cells.
 func (w *Window) CountPixels() int {
 	count := 0
 	for i := 0; i < int(w.Width) * int(w.Height) * 4; i += 4 {
-		if w.pixels[i] == 0xFF {
+		if w.pixels[i] == 0xFF && w.pixels[i+1] == 0xFF && w.pixels[i+2] == 0xFF && w.pixels[i+3] == 0xFF {
 			count++
 		}
 	}
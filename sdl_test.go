@@ -15,6 +15,9 @@ import (
 var sdlEvents chan gol.Event
 var sdlAlive chan int
 
+// sdlWindow is the window the tests are shown in, which is nil when -noVis is given.
+var sdlWindow *sdl.Window
+
 func TestMain(m *testing.M) {
 	runtime.LockOSThread()
 	noVis := flag.Bool("noVis", false,
@@ -36,6 +39,7 @@ func TestMain(m *testing.M) {
 	if !(*noVis) {
 		w = sdl.NewWindow(int32(p.ImageWidth), int32(p.ImageHeight))
 	}
+	sdlWindow = w
 
 	board := make([][]byte, p.ImageHeight)
 	for i := 0; i < p.ImageHeight; i++ {
@@ -59,6 +63,11 @@ sdlLoop:
 				if w != nil {
 					w.FlipPixel(e.Cell.X, e.Cell.Y)
 				}
+			case gol.CellShaded:
+				board[e.Cell.Y][e.Cell.X] = e.Level
+				if w != nil {
+					w.ShadePixel(e.Cell.X, e.Cell.Y, e.Level)
+				}
 			case gol.TurnComplete:
 				if w != nil {
 					w.RenderFrame()
@@ -104,6 +113,8 @@ func TestSdl(t *testing.T) {
 			switch e := event.(type) {
 			case gol.CellFlipped:
 				sdlEvents <- e
+			case gol.CellShaded:
+				sdlEvents <- e
 			case gol.TurnComplete:
 				turnNum++
 				sdlEvents <- e
@@ -126,3 +137,25 @@ func TestSdl(t *testing.T) {
 		}
 	})
 }
+
+// TestShadePixel checks that a pixel shaded as a dead cell is flipped to an opaque white pixel, as a
+// cleared one is, so a cell that dies out under a Generations rule is shown when it is born again.
+// Nothing is sent to the window while it runs, so the pixels can be changed from the test.
+func TestShadePixel(t *testing.T) {
+	w := sdlWindow
+	if w == nil {
+		t.Skip("there is no window with -noVis")
+	}
+	w.ClearPixels()
+	defer w.ClearPixels()
+
+	w.ShadePixel(0, 0, 0)
+	if count := w.CountPixels(); count != 0 {
+		t.Fatalf("%d pixels are white after shading one as dead, expected 0", count)
+	}
+	w.FlipPixel(0, 0)
+	w.FlipPixel(1, 0)
+	if count := w.CountPixels(); count != 2 {
+		t.Errorf("%d pixels are opaque white after flipping a dead shaded pixel and a cleared one, expected 2", count)
+	}
+}
@@ -1,5 +1,11 @@
 package stubs
 
+import (
+	"net/rpc"
+
+	"uk.ac.bris.cs/gameoflife/golUtils"
+)
+
 type Stub string
 
 var SendWorldData Stub = "GOLWorker.ReceiveWorldData"
@@ -13,10 +19,254 @@ var UnPauseCalculations Stub = "GOLWorker.UnPauseCalculations"
 var StopCalculations Stub = "GOLWorker.StopCalculations"
 var SendCurrentState Stub = "GOLWorker.SendCurrent"
 
-type Response struct {
-	Message string
+var Shutdown Stub = "GOLWorker.Shutdown"
+
+var AttachSession Stub = "GOLWorker.AttachSession"
+var DetachSession Stub = "GOLWorker.DetachSession"
+var AwaitCalculation Stub = "GOLWorker.AwaitCalculation"
+var CloseSession Stub = "GOLWorker.CloseSession"
+var SendFlips Stub = "GOLWorker.SendFlips"
+
+var CalculateSection Stub = "GOLWorker.CalculateSection"
+
+var LoadStrip Stub = "GOLWorker.LoadStrip"
+var StepStrip Stub = "GOLWorker.StepStrip"
+var ReceiveHalo Stub = "GOLWorker.ReceiveHalo"
+var SendStrip Stub = "GOLWorker.SendStrip"
+var ReleaseStrip Stub = "GOLWorker.ReleaseStrip"
+
+var RegisterWorker Stub = "Broker.RegisterWorker"
+var DeregisterWorker Stub = "Broker.DeregisterWorker"
+var ListWorkers Stub = "Broker.ListWorkers"
+
+// ErrorCode is returned as the error of an RPC method. net/rpc only sends the error's string
+// across the wire, so the caller should use CodeOf to turn it back into an ErrorCode.
+type ErrorCode int
+
+const (
+	Unknown ErrorCode = iota
+	BadRequest
+	NoWorld
+	Busy
+	AlreadyPaused
+	NotPaused
+	NoWorkers
+	NotRegistered
+	NoSession
+	Unsupported
+)
+
+func (code ErrorCode) Error() string {
+	switch code {
+	case BadRequest:
+		return "bad request"
+	case NoWorld:
+		return "no world has been received"
+	case Busy:
+		return "currently doing a calculation"
+	case AlreadyPaused:
+		return "calculations already paused"
+	case NotPaused:
+		return "calculations aren't paused"
+	case NoWorkers:
+		return "no workers available"
+	case NotRegistered:
+		return "worker isn't registered"
+	case NoSession:
+		return "no such session"
+	case Unsupported:
+		return "not supported by this server"
+	default:
+		return "unknown error"
+	}
+}
+
+// CodeOf converts an error returned by rpc.Client.Call back into an ErrorCode.
+func CodeOf(err error) ErrorCode {
+	if err == nil {
+		return Unknown
+	}
+	if code, ok := err.(ErrorCode); ok {
+		return code
+	}
+	if serverErr, ok := err.(rpc.ServerError); ok {
+		for code := BadRequest; code <= Unsupported; code++ {
+			if string(serverErr) == code.Error() {
+				return code
+			}
+		}
+	}
+	return Unknown
+}
+
+// Empty is used for calls which don't need to send or return any data.
+type Empty struct{}
+
+// SessionRequest picks which of the simulations hosted by a server a call is for.
+type SessionRequest struct {
+	Session int
+}
+
+type SessionResponse struct {
+	Session int
+}
+
+// WorldRequest uploads a world and the parameters to run it with, starting a new session.
+// Turn is the number of turns already completed, so a calculation can be resumed.
+// On the infinite plane the world can be bigger than the image, and Origin is where the image is in it.
+type WorldRequest struct {
+	Params golUtils.Params
+	World  golUtils.PackedWorld
+	Origin golUtils.CoOrds
+	Turn   int
+}
+
+// Unpack decodes the world, returning BadRequest if it is empty or doesn't fit the parameters.
+func (req WorldRequest) Unpack() (golUtils.World, error) {
+	if req.Params.ImageWidth <= 0 || req.Params.ImageHeight <= 0 {
+		return nil, BadRequest
+	}
+	world, err := req.World.Unpack()
+	if err != nil || req.Turn < 0 || req.Origin.X < 0 || req.Origin.Y < 0 {
+		return nil, BadRequest
+	}
+	width := req.Origin.X + req.Params.ImageWidth
+	height := req.Origin.Y + req.Params.ImageHeight
+	if req.Params.Boundary == golUtils.Infinite {
+		if req.World.Width < width || req.World.Height < height {
+			return nil, BadRequest
+		}
+	} else if req.World.Width != width || req.World.Height != height {
+		return nil, BadRequest
+	}
+	return world, nil
+}
+
+// TurnsRequest asks for a number of turns to be calculated.
+type TurnsRequest struct {
+	Session int
+	Turns   int
+}
+
+type TurnResponse struct {
+	CompletedTurns int
+}
+
+type CellCountResponse struct {
+	CompletedTurns int
+	AliveCells     int
+}
+
+type StateResponse struct {
+	CompletedTurns int
+	World          golUtils.PackedWorld
+	Origin         golUtils.CoOrds
+}
+
+// StatusResponse describes what a server is running, so a controller can attach to it.
+type StatusResponse struct {
+	Params         golUtils.Params
+	Calculating    bool
+	Paused         bool
+	CompletedTurns int
+}
+
+// FlipsRequest asks for the cells of the image that have changed since Since, the turn the controller
+// was last sent. A Since of -1 starts watching, and gets every cell that isn't dead.
+// Paused is whether the controller was last told the calculation is paused.
+type FlipsRequest struct {
+	Session int
+	Since   int
+	Paused  bool
+}
+
+// FlipsResponse lists the cells that have changed, merging together every turn since the last request.
+// Reset is set when the flips are from an empty world rather than from Since, e.g. for a new watcher.
+// Paused says whether the calculation is paused at CompletedTurns, so every controller watching it agrees.
+// Finished is set once the calculation has finished, so there is nothing more to watch.
+type FlipsResponse struct {
+	CompletedTurns int
+	Flips          []golUtils.Flip
+	Reset          bool
+	Paused         bool
+	Finished       bool
+}
+
+// SectionRequest holds a strip of the world with one halo row above and below it.
+type SectionRequest struct {
+	Params  golUtils.Params
+	Section golUtils.PackedWorld
+}
+
+// SectionResponse holds the next state of the strip, without the halo rows.
+type SectionResponse struct {
+	Section golUtils.PackedWorld
+}
+
+// StripRequest gives a worker ownership of a strip of the world in halo exchange mode,
+// along with the addresses of the workers that own the strips above and below it.
+// Session identifies the strip on every worker. The broker picks it at random, so strips
+// from different sessions, or different brokers, don't collide.
+// First and Last are set for the strips at the top and bottom of the world, whose halo rows
+// from across the edge of the world have to follow the boundary in Params.
+type StripRequest struct {
+	Session int
+	Params  golUtils.Params
+	Strip   golUtils.PackedWorld
+	Turn    int
+	Above   string
+	Below   string
+	First   bool
+	Last    bool
+}
+
+// StripFlips lists the cells of a strip that have changed since the broker was last sent it, with Y counted
+// from the top of the strip. Reset is set when the worker no longer has the strip as the broker was last sent
+// it, and the flips are from a dead strip instead.
+type StripFlips struct {
+	Flips []golUtils.Flip
+	Reset bool
+}
+
+// StepRequest tells a worker to advance its strip from the given turn by one turn. With View set, the worker
+// also sends back what has changed since the broker was last sent the strip, at turn Since.
+type StepRequest struct {
+	Session int
+	Turn    int
+	View    bool
+	Since   int
+}
+
+type StepResponse struct {
+	AliveCells int
+	Changes    StripFlips
+}
+
+// StripFlipsRequest asks a worker what has changed in its strip since the broker was last sent it, at turn Since.
+type StripFlipsRequest struct {
+	Session int
+	Since   int
+}
+
+type StripFlipsResponse struct {
+	CompletedTurns int
+	Changes        StripFlips
+}
+
+// HaloRequest sends the edge row of a strip to a neighbouring worker.
+// FromAbove is set when the row is the bottom row of the strip above the receiver.
+type HaloRequest struct {
+	Session   int
+	Turn      int
+	FromAbove bool
+	Row       golUtils.PackedWorld
+}
+
+type WorkerInfo struct {
+	Address  string
+	Capacity int
 }
 
-type Request struct {
-	Message string
+type WorkerListResponse struct {
+	Workers []WorkerInfo
 }